@@ -0,0 +1,37 @@
+// Package testutil holds helpers shared by the tests of the format packages
+package testutil
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// RoundTrip reads `data` with `read`, writes the resulting file with `write` and fails `t`
+// when the written data differs from `data`
+// The file that was read is returned, so that the test can check its contents
+func RoundTrip[F any](t *testing.T, data []byte, read func(io.Reader) (F, error), write func(io.Writer, F) error) F {
+	t.Helper()
+
+	f, err := read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := write(out, f); err != nil {
+		t.Fatal(err)
+	}
+
+	written := out.Bytes()
+	for i := 0; i < len(written) && i < len(data); i++ {
+		if written[i] != data[i] {
+			t.Errorf("written file differs from the original at offset %#x", i)
+			return f
+		}
+	}
+	if len(written) != len(data) {
+		t.Errorf("written file is %d bytes long, the original %d bytes", len(written), len(data))
+	}
+	return f
+}
@@ -0,0 +1,39 @@
+package util
+
+const (
+	// ADPCM4TableSize is the size of the delta table at the start of 4-bit ADPCM packed sample data
+	ADPCM4TableSize = 16
+)
+
+// ADPCM4PackedLength returns the number of bytes used by `frames` samples of 4-bit ADPCM packed data
+func ADPCM4PackedLength(frames int) int {
+	return ADPCM4TableSize + (frames+1)/2
+}
+
+// DecodeADPCM4 unpacks `frames` samples of ModPlug 4-bit ADPCM data into signed 8-bit PCM
+// The data starts with a table of 16 signed deltas, followed by one nibble (low nibble first) per sample,
+// each of which selects the delta to add to the previous sample value.
+// Data that ends early holds the last decoded value for the rest of the sample, as if the missing
+// nibbles selected a delta of zero.
+func DecodeADPCM4(data []byte, frames int) []byte {
+	out := make([]byte, frames)
+	if len(data) < ADPCM4TableSize {
+		return out
+	}
+
+	table := data[:ADPCM4TableSize]
+	packed := data[ADPCM4TableSize:]
+
+	var v uint8
+	for i := 0; i < frames; i++ {
+		if i/2 < len(packed) {
+			nibble := packed[i/2]
+			if i&1 != 0 {
+				nibble >>= 4
+			}
+			v += table[nibble&0x0F]
+		}
+		out[i] = v
+	}
+	return out
+}
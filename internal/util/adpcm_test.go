@@ -0,0 +1,37 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testADPCM4Block is a ModPlug delta table, followed by the nibbles 1, 2, 15 and 9
+var testADPCM4Block = []byte{
+	0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40,
+	0xFF, 0xFE, 0xFC, 0xF8, 0xF0, 0xE0, 0xD0, 0xC0,
+	0x21, 0x9F,
+}
+
+func TestDecodeADPCM4(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		frames   int
+		expected []byte
+	}{
+		{"whole bytes", testADPCM4Block, 4, []byte{0x01, 0x03, 0xC3, 0xC1}},
+		// the high nibble of the last byte is unused
+		{"odd length", testADPCM4Block, 3, []byte{0x01, 0x03, 0xC3}},
+		// the samples beyond the data hold the last value
+		{"truncated", testADPCM4Block[:ADPCM4TableSize+1], 4, []byte{0x01, 0x03, 0x03, 0x03}},
+		{"truncated table", testADPCM4Block[:ADPCM4TableSize-1], 2, []byte{0x00, 0x00}},
+	} {
+		if out := DecodeADPCM4(tc.data, tc.frames); !bytes.Equal(out, tc.expected) {
+			t.Errorf("%s: unexpected sample data % x", tc.name, out)
+		}
+	}
+
+	if n := ADPCM4PackedLength(3); n != ADPCM4TableSize+2 {
+		t.Errorf("unexpected packed length %d", n)
+	}
+}
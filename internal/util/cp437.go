@@ -0,0 +1,49 @@
+package util
+
+import "strings"
+
+// cp437High is the mapping of the upper half (0x80-0xFF) of code page 437 to unicode
+var cp437High = []rune("" +
+	"ÇüéâäàåçêëèïîìÄÅ" +
+	"ÉæÆôöòûùÿÖÜ¢£¥₧ƒ" +
+	"áíóúñÑªº¿⌐¬½¼¡«»" +
+	"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐" +
+	"└┴┬├─┼╞╟╚╔╩╦╠═╬╧" +
+	"╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩" +
+	"≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ ")
+
+// DecodeCP437 converts text stored in code page 437 into a (UTF-8) string
+// The lower half is treated as ASCII, so control characters keep their usual meaning.
+func DecodeCP437(data []byte) string {
+	var sb strings.Builder
+	for _, c := range data {
+		if c < 0x80 {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteRune(cp437High[c-0x80])
+		}
+	}
+	return sb.String()
+}
+
+// EncodeCP437 converts a (UTF-8) string into code page 437
+// Characters that code page 437 can't represent are replaced with '?'.
+func EncodeCP437(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r < 0x80 {
+			out = append(out, byte(r))
+			continue
+		}
+		c := byte('?')
+		for i, h := range cp437High {
+			if h == r {
+				c = byte(0x80 + i)
+				break
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
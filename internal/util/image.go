@@ -0,0 +1,108 @@
+package util
+
+import "errors"
+
+var (
+	// ErrImageConflict is returned when data is placed over previously placed data with different contents
+	ErrImageConflict = errors.New("conflicting data in image")
+)
+
+// Span is a range of bytes within a file
+type Span struct {
+	Offset int
+	Length int
+}
+
+// Coverage keeps track of which bytes of a file have been consumed by a reader
+type Coverage struct {
+	used []bool
+}
+
+// NewCoverage creates a coverage tracker for a file of `size` bytes
+func NewCoverage(size int) *Coverage {
+	return &Coverage{
+		used: make([]bool, size),
+	}
+}
+
+// Mark flags `n` bytes starting at offset `ofs` as consumed
+// Any part of the range that lies outside of the file is ignored
+func (c *Coverage) Mark(ofs int, n int) {
+	if ofs < 0 {
+		n += ofs
+		ofs = 0
+	}
+	end := ofs + n
+	if end > len(c.used) {
+		end = len(c.used)
+	}
+	for i := ofs; i < end; i++ {
+		c.used[i] = true
+	}
+}
+
+// Gaps returns all the ranges of the file that have not been consumed
+func (c *Coverage) Gaps() []Span {
+	var gaps []Span
+	for i := 0; i < len(c.used); {
+		if c.used[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(c.used) && !c.used[i] {
+			i++
+		}
+		gaps = append(gaps, Span{
+			Offset: start,
+			Length: i - start,
+		})
+	}
+	return gaps
+}
+
+// Image is a file assembled from chunks of data placed at absolute offsets
+type Image struct {
+	data []byte
+	used []bool
+}
+
+// Place copies `b` into the image at offset `ofs`, growing the image as needed
+// Overlapping previously placed data is only allowed when the contents are identical
+func (im *Image) Place(ofs int, b []byte) error {
+	if ofs < 0 {
+		return errors.New("offset out of range")
+	}
+
+	im.Grow(ofs + len(b))
+	for i, v := range b {
+		if im.used[ofs+i] && im.data[ofs+i] != v {
+			return ErrImageConflict
+		}
+	}
+
+	copy(im.data[ofs:], b)
+	for i := range b {
+		im.used[ofs+i] = true
+	}
+	return nil
+}
+
+// Grow extends the image with zeroes until it is at least `size` bytes long
+func (im *Image) Grow(size int) {
+	if n := size - len(im.data); n > 0 {
+		im.data = append(im.data, make([]byte, n)...)
+		im.used = append(im.used, make([]bool, n)...)
+	}
+}
+
+// Len returns the current size of the image
+func (im *Image) Len() int {
+	return len(im.data)
+}
+
+// Bytes returns the contents of the image
+// Any bytes that were never placed are zero
+func (im *Image) Bytes() []byte {
+	return im.data
+}
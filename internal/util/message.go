@@ -0,0 +1,20 @@
+package util
+
+import "bytes"
+
+// MessageBytes returns the song message `msg`, stored with CR line endings, up to its NUL terminator
+// (if any) and with the line endings converted to LF
+func MessageBytes(msg []byte) []byte {
+	if n := bytes.IndexByte(msg, 0); n != -1 {
+		msg = msg[:n]
+	}
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(msg, []byte("\r"), []byte("\n"))
+}
+
+// EncodeMessage encodes the (UTF-8) song message `text` as code page 437, with CR line endings
+func EncodeMessage(text string) []byte {
+	msg := EncodeCP437(text)
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\r"))
+	return bytes.ReplaceAll(msg, []byte("\n"), []byte("\r"))
+}
@@ -0,0 +1,25 @@
+package util
+
+// ReadOption is an optional setting for the Read function of a format package
+type ReadOption func(*ReadOptions)
+
+// ReadOptions are the settings that a list of ReadOption values selects
+type ReadOptions struct {
+	PreserveUnparsed bool
+}
+
+// PreserveUnparsed selects the PreserveUnparsed setting
+func PreserveUnparsed() ReadOption {
+	return func(o *ReadOptions) {
+		o.PreserveUnparsed = true
+	}
+}
+
+// GetReadOptions applies the options `opts` to the default settings
+func GetReadOptions(opts []ReadOption) ReadOptions {
+	var o ReadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,122 @@
+// Package pcm provides a normalized sample representation shared by the tracked music formats
+package pcm
+
+import "encoding/binary"
+
+// LoopMode is the way a sample loop is played
+type LoopMode uint8
+
+const (
+	// LoopModeDisabled is no loop
+	LoopModeDisabled = LoopMode(iota)
+	// LoopModeForward plays from the loop begin to the loop end, then repeats from the loop begin
+	LoopModeForward
+	// LoopModePingPong plays from the loop begin to the loop end, then inverts playback back to the loop begin
+	// (and continues this way)
+	LoopModePingPong
+)
+
+// Loop is a sample loop, described in sample frames
+type Loop struct {
+	Mode  LoopMode
+	Begin int
+	End   int // the first frame after the loop
+}
+
+// NewLoop returns a loop with the mode `mode` from `begin` to `end`, limited to a sample of `frames` sample frames
+// Loops that are empty after being limited are disabled.
+func NewLoop(mode LoopMode, begin int, end int, frames int) Loop {
+	if end > frames {
+		end = frames
+	}
+	if mode == LoopModeDisabled || begin < 0 || begin >= end {
+		return Loop{}
+	}
+	return Loop{
+		Mode:  mode,
+		Begin: begin,
+		End:   end,
+	}
+}
+
+// IsEnabled returns true if the loop is enabled
+func (l Loop) IsEnabled() bool {
+	return l.Mode != LoopModeDisabled && l.Begin < l.End
+}
+
+// Sample is a normalized PCM sample
+type Sample struct {
+	Channels      int
+	BitsPerSample int     // the bit depth of the original sample data
+	BaseFrequency float64 // the playback rate, in Hz, that plays the sample at the format's reference (middle C) note
+	Loop          Loop
+	SustainLoop   Loop
+	Data          []int16 // full-scale signed values, with the channels of each frame interleaved
+}
+
+// FromSigned8 creates a sample from signed 8-bit PCM `data`, with the channels of each frame interleaved
+func FromSigned8(data []byte, channels int) *Sample {
+	s := Sample{
+		Channels:      channels,
+		BitsPerSample: 8,
+		Data:          make([]int16, len(data)),
+	}
+	for i, v := range data {
+		s.Data[i] = int16(int8(v)) << 8
+	}
+	return &s
+}
+
+// FromSigned16LE creates a sample from signed little-endian 16-bit PCM `data`, with the channels of each frame interleaved
+func FromSigned16LE(data []byte, channels int) *Sample {
+	s := Sample{
+		Channels:      channels,
+		BitsPerSample: 16,
+		Data:          make([]int16, len(data)/2),
+	}
+	for i := range s.Data {
+		s.Data[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return &s
+}
+
+// Frames returns the length of the sample in sample frames
+func (s *Sample) Frames() int {
+	if s.Channels <= 0 {
+		return 0
+	}
+	return len(s.Data) / s.Channels
+}
+
+// Int16 returns the sample data as full-scale signed 16-bit values, with the channels of each frame interleaved
+func (s *Sample) Int16() []int16 {
+	return s.Data
+}
+
+// Float32 returns the sample data as values in the range [-1, 1), with the channels of each frame interleaved
+func (s *Sample) Float32() []float32 {
+	out := make([]float32, len(s.Data))
+	for i, v := range s.Data {
+		out[i] = float32(v) / 32768
+	}
+	return out
+}
+
+// Interleave converts sample data with the channels stored one after the other (each `bytesPerSample` bytes wide)
+// into sample data with the channels of each frame interleaved
+func Interleave(planar []byte, channels int, bytesPerSample int) []byte {
+	if channels <= 1 {
+		return planar
+	}
+
+	channelLen := len(planar) / channels / bytesPerSample * bytesPerSample
+	frames := channelLen / bytesPerSample
+	out := make([]byte, frames*channels*bytesPerSample)
+	for i := 0; i < frames; i++ {
+		for c := 0; c < channels; c++ {
+			src := planar[c*channelLen+i*bytesPerSample:]
+			copy(out[(i*channels+c)*bytesPerSample:], src[:bytesPerSample])
+		}
+	}
+	return out
+}
@@ -40,6 +40,7 @@ func (b *blockBase) Length() int {
 
 type Unknown struct {
 	blockBase
+	Data []byte
 }
 
 // FourCC returns the big-endian representation of the block identifier
@@ -0,0 +1,17 @@
+package block
+
+// ChannelPlugins is a CHFX block
+type ChannelPlugins struct {
+	blockBase
+	Plugin []uint32 // the plugin each channel is routed to (0 = none, otherwise the 1-based plugin number)
+}
+
+// FourCC returns the big-endian representation of the block identifier
+func (b *ChannelPlugins) FourCC() uint32 {
+	return b.blockBase.FourCC()
+}
+
+// Length returns the size of the whole block
+func (b *ChannelPlugins) Length() int {
+	return b.blockBase.Length()
+}
@@ -0,0 +1,25 @@
+package block
+
+import "github.com/gotracker/goaudiofile/internal/util"
+
+type ChannelName [20]byte
+
+func (n *ChannelName) String() string {
+	return util.GetString((*n)[:])
+}
+
+// ChannelNames is a CNAM block
+type ChannelNames struct {
+	blockBase
+	Name []ChannelName
+}
+
+// FourCC returns the big-endian representation of the block identifier
+func (b *ChannelNames) FourCC() uint32 {
+	return b.blockBase.FourCC()
+}
+
+// Length returns the size of the whole block
+func (b *ChannelNames) Length() int {
+	return b.blockBase.Length()
+}
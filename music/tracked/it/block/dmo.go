@@ -0,0 +1,247 @@
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotDMO is for when DMO parameters are requested from a plugin that is not a DMO plugin
+	ErrNotDMO = errors.New("plugin is not a DMO plugin")
+	// ErrUnknownDMO is for when the DMO plugin is not one of the standard DirectX Media Objects
+	ErrUnknownDMO = errors.New("unknown DMO plugin")
+	// ErrDMOParameterLength is for when the plugin data is not a parameter list of the size of the DMO parameters
+	ErrDMOParameterLength = errors.New("DMO parameter data does not match the plugin")
+)
+
+// DMOParameters is the set of parameters of one of the standard DirectX Media Objects
+// All of the parameters are stored as normalized values, ranging from 0 to 1.
+type DMOParameters interface {
+	// DMOName returns the name used as the library name of the plugin
+	DMOName() string
+	// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+	DMOUniqueID() uint32
+}
+
+// DMOChorus is the set of parameters of the Chorus DMO
+type DMOChorus struct {
+	WetDryMix float32
+	Depth     float32
+	Frequency float32
+	Waveform  float32
+	Phase     float32
+	Feedback  float32
+	Delay     float32
+}
+
+// DMOCompressor is the set of parameters of the Compressor DMO
+type DMOCompressor struct {
+	Gain      float32
+	Attack    float32
+	Release   float32
+	Threshold float32
+	Ratio     float32
+	Predelay  float32
+}
+
+// DMODistortion is the set of parameters of the Distortion DMO
+type DMODistortion struct {
+	Gain                  float32
+	Edge                  float32
+	PostEQCenterFrequency float32
+	PostEQBandwidth       float32
+	PreLowpassCutoff      float32
+}
+
+// DMOEcho is the set of parameters of the Echo DMO
+type DMOEcho struct {
+	WetDryMix  float32
+	Feedback   float32
+	LeftDelay  float32
+	RightDelay float32
+	PanDelay   float32
+}
+
+// DMOFlanger is the set of parameters of the Flanger DMO
+type DMOFlanger struct {
+	WetDryMix float32
+	Depth     float32
+	Frequency float32
+	Waveform  float32
+	Phase     float32
+	Feedback  float32
+	Delay     float32
+}
+
+// DMOGargle is the set of parameters of the Gargle DMO
+type DMOGargle struct {
+	RateHz    float32
+	WaveShape float32
+}
+
+// DMOI3DL2Reverb is the set of parameters of the I3DL2Reverb DMO
+type DMOI3DL2Reverb struct {
+	Room              float32
+	RoomHF            float32
+	RoomRolloffFactor float32
+	DecayTime         float32
+	DecayHFRatio      float32
+	Reflections       float32
+	ReflectionsDelay  float32
+	Reverb            float32
+	ReverbDelay       float32
+	Diffusion         float32
+	Density           float32
+	HFReference       float32
+	Quality           float32
+}
+
+// DMOParamEQ is the set of parameters of the ParamEq DMO
+type DMOParamEQ struct {
+	Center    float32
+	Bandwidth float32
+	Gain      float32
+}
+
+// DMOWavesReverb is the set of parameters of the WavesReverb DMO
+type DMOWavesReverb struct {
+	InGain          float32
+	ReverbMix       float32
+	ReverbTime      float32
+	HighFreqRTRatio float32
+}
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOChorus) DMOName() string { return "Chorus" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOCompressor) DMOName() string { return "Compressor" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMODistortion) DMOName() string { return "Distortion" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOEcho) DMOName() string { return "Echo" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOFlanger) DMOName() string { return "Flanger" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOGargle) DMOName() string { return "Gargle" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOI3DL2Reverb) DMOName() string { return "I3DL2Reverb" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOParamEQ) DMOName() string { return "ParamEq" }
+
+// DMOName returns the name used as the library name of the plugin
+func (p *DMOWavesReverb) DMOName() string { return "WavesReverb" }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOChorus) DMOUniqueID() uint32 { return 0xEFE6629C }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOCompressor) DMOUniqueID() uint32 { return 0xEF011F79 }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMODistortion) DMOUniqueID() uint32 { return 0xEF114C90 }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOEcho) DMOUniqueID() uint32 { return 0xEF3E932C }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOFlanger) DMOUniqueID() uint32 { return 0xEFCA3D92 }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOGargle) DMOUniqueID() uint32 { return 0xDAFD8210 }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOI3DL2Reverb) DMOUniqueID() uint32 { return 0xEF985E71 }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOParamEQ) DMOUniqueID() uint32 { return 0x120CED89 }
+
+// DMOUniqueID returns the first part of the class ID of the plugin, used as the unique ID of the plugin
+func (p *DMOWavesReverb) DMOUniqueID() uint32 { return 0x87FC0268 }
+
+// newDMOParameters returns an empty set of parameters of the DMO identified by `uniqueID` or (failing that) `name`
+func newDMOParameters(uniqueID uint32, name string) DMOParameters {
+	all := []DMOParameters{
+		&DMOChorus{},
+		&DMOCompressor{},
+		&DMODistortion{},
+		&DMOEcho{},
+		&DMOFlanger{},
+		&DMOGargle{},
+		&DMOI3DL2Reverb{},
+		&DMOParamEQ{},
+		&DMOWavesReverb{},
+	}
+	for _, p := range all {
+		if p.DMOUniqueID() == uniqueID {
+			return p
+		}
+	}
+	for _, p := range all {
+		if strings.EqualFold(p.DMOName(), name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// DMOParameters decodes the plugin data of a DMO plugin into its typed set of parameters
+// The plugin is identified by its unique ID, or by its library name if the unique ID is not recognized.
+func (b *FX) DMOParameters() (DMOParameters, error) {
+	if b.PluginType != PluginTypeDMO {
+		return nil, ErrNotDMO
+	}
+
+	p := newDMOParameters(binary.LittleEndian.Uint32(b.UniqueID[:]), b.LibraryName.String())
+	if p == nil {
+		return nil, ErrUnknownDMO
+	}
+
+	// the parameters follow the data type tag
+	if len(b.Data) != pluginDataTypeLen+binary.Size(p) || binary.LittleEndian.Uint32(b.Data) != pluginDataTypeParameters {
+		return nil, ErrDMOParameterLength
+	}
+
+	if err := binary.Read(bytes.NewReader(b.Data[pluginDataTypeLen:]), binary.LittleEndian, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// EncodeDMOParameters encodes the typed set of parameters `p` into plugin data, following the data type tag
+func EncodeDMOParameters(p DMOParameters) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, pluginDataTypeParameters); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.LittleEndian, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SetDMOParameters encodes the typed set of parameters `p` into the plugin data,
+// and identifies the plugin as the matching DMO plugin
+func (b *FX) SetDMOParameters(p DMOParameters) error {
+	data, err := EncodeDMOParameters(p)
+	if err != nil {
+		return err
+	}
+
+	b.PluginType = PluginTypeDMO
+	binary.LittleEndian.PutUint32(b.UniqueID[:], p.DMOUniqueID())
+	b.LibraryName = FXLibraryName{}
+	copy(b.LibraryName[:], p.DMOName())
+	b.Data = data
+	b.DataLength = uint32(len(b.Data))
+	return nil
+}
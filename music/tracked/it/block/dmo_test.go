@@ -0,0 +1,79 @@
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// echoPluginData is the plugin data of an Echo DMO, laid out the way OpenMPT saves it:
+// the data type tag (0 = parameter list), followed by the normalized parameters
+var echoPluginData = []byte{
+	0x00, 0x00, 0x00, 0x00, // data type
+	0x00, 0x00, 0x00, 0x3F, // WetDryMix = 0.5
+	0x00, 0x00, 0x00, 0x3F, // Feedback = 0.5
+	0x00, 0x00, 0x80, 0x3E, // LeftDelay = 0.25
+	0x00, 0x00, 0x80, 0x3E, // RightDelay = 0.25
+	0x00, 0x00, 0x00, 0x00, // PanDelay = 0
+}
+
+func newEchoFX() *FX {
+	fx := &FX{
+		PluginType: PluginTypeDMO,
+		Data:       append([]byte{}, echoPluginData...),
+		DataLength: uint32(len(echoPluginData)),
+	}
+	binary.LittleEndian.PutUint32(fx.UniqueID[:], 0xEF3E932C)
+	copy(fx.LibraryName[:], "Echo")
+	return fx
+}
+
+func TestDMOParameters(t *testing.T) {
+	p, err := newEchoFX().DMOParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	echo, ok := p.(*DMOEcho)
+	if !ok {
+		t.Fatalf("unexpected parameter type %T", p)
+	}
+
+	expected := DMOEcho{
+		WetDryMix:  0.5,
+		Feedback:   0.5,
+		LeftDelay:  0.25,
+		RightDelay: 0.25,
+	}
+	if *echo != expected {
+		t.Errorf("unexpected parameters %+v", *echo)
+	}
+}
+
+func TestDMOParametersRoundTrip(t *testing.T) {
+	fx := newEchoFX()
+	p, err := fx.DMOParameters()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &FX{}
+	if err := out.SetDMOParameters(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out.Data, echoPluginData) {
+		t.Errorf("unexpected plugin data % x", out.Data)
+	}
+	if out.UniqueID != fx.UniqueID || out.LibraryName != fx.LibraryName {
+		t.Errorf("unexpected plugin identification")
+	}
+}
+
+func TestDMOParametersWithoutDataType(t *testing.T) {
+	fx := newEchoFX()
+	fx.Data = fx.Data[pluginDataTypeLen:]
+	if _, err := fx.DMOParameters(); err != ErrDMOParameterLength {
+		t.Errorf("expected ErrDMOParameterLength, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package block
+
+import "encoding/binary"
+
+// FieldCode is the code identifying a field of the XTPM and STPM blocks
+// Codes are stored in the file as little-endian values, so their characters appear reversed.
+type FieldCode uint32
+
+func (c FieldCode) String() string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(c))
+	return string(b[:])
+}
+
+// fieldValue returns the little-endian integer value of the field data `data`
+func fieldValue(data []byte) uint64 {
+	var v uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+	return v
+}
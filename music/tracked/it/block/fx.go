@@ -9,6 +9,15 @@ var (
 	PluginTypeDMO = FXPluginType{'O', 'M', 'X', 'D'}
 )
 
+const (
+	// pluginDataTypeLen is the size of the data type tag that starts the plugin data
+	pluginDataTypeLen = 4
+	// pluginDataTypeParameters is the data type tag of plugin data holding a list of parameter values
+	pluginDataTypeParameters = uint32(0)
+	// pluginDataTypeChunk is the data type tag of plugin data holding an opaque chunk
+	pluginDataTypeChunk = "fEvN"
+)
+
 type FXGainFactor uint8
 
 // Value returns the value as a multiplier
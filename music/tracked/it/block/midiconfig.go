@@ -0,0 +1,101 @@
+package block
+
+import "github.com/gotracker/goaudiofile/internal/util"
+
+const (
+	// MIDIConfigSize is the size of a stored MIDI configuration
+	MIDIConfigSize = 4896
+)
+
+const (
+	// MIDIGlobalStart is the index of the global macro sent when playback starts
+	MIDIGlobalStart = iota
+	// MIDIGlobalStop is the index of the global macro sent when playback stops
+	MIDIGlobalStop
+	// MIDIGlobalTick is the index of the global macro sent on every tick
+	MIDIGlobalTick
+	// MIDIGlobalNoteOn is the index of the global macro sent when a note starts
+	MIDIGlobalNoteOn
+	// MIDIGlobalNoteOff is the index of the global macro sent when a note stops
+	MIDIGlobalNoteOff
+	// MIDIGlobalVolume is the index of the global macro sent when the volume changes
+	MIDIGlobalVolume
+	// MIDIGlobalPan is the index of the global macro sent when the panning changes
+	MIDIGlobalPan
+	// MIDIGlobalBankChange is the index of the global macro sent when the bank changes
+	MIDIGlobalBankChange
+	// MIDIGlobalProgramChange is the index of the global macro sent when the program changes
+	MIDIGlobalProgramChange
+)
+
+// MIDIMacro is a single MIDI macro, stored as a NUL-terminated string of hexadecimal digits and parameter letters
+type MIDIMacro [32]byte
+
+// String returns a string representation of the macro
+func (m MIDIMacro) String() string {
+	return util.GetString(m[:])
+}
+
+// MIDIMacroParams are the values that the parameter letters of a MIDI macro are replaced with
+type MIDIMacroParams struct {
+	Channel  uint8 // c: the MIDI channel (0-15)
+	Note     uint8 // n: the note
+	Velocity uint8 // v: the note velocity
+	Z        uint8 // z: the parameter of the effect that sent the macro
+}
+
+// Evaluate expands the macro into raw MIDI bytes
+// Pairs of hexadecimal digits form a byte and `c` stands for a single hexadecimal digit (the channel),
+// while `n`, `v` and `z` each stand for a whole byte. A lone digit before a whole byte (or at the end of the macro)
+// is sent as a byte of its own. Spaces and any other characters are ignored.
+func (m MIDIMacro) Evaluate(p MIDIMacroParams) []byte {
+	var out []byte
+	var data uint8
+	pending := false
+
+	nibble := func(v uint8) {
+		data = data<<4 | v&0x0F
+		if pending {
+			out = append(out, data)
+			data = 0
+		}
+		pending = !pending
+	}
+	value := func(v uint8) {
+		if pending {
+			out = append(out, data)
+			data = 0
+			pending = false
+		}
+		out = append(out, v&0x7F)
+	}
+
+	for _, c := range m.String() {
+		switch {
+		case c >= '0' && c <= '9':
+			nibble(uint8(c - '0'))
+		case c >= 'A' && c <= 'F':
+			nibble(uint8(c-'A') + 10)
+		case c == 'c':
+			nibble(p.Channel)
+		case c == 'n':
+			value(p.Note)
+		case c == 'v':
+			value(p.Velocity)
+		case c == 'z':
+			value(p.Z)
+		}
+	}
+
+	if pending {
+		out = append(out, data)
+	}
+	return out
+}
+
+// MIDIConfig is the MIDI macro configuration embedded in an IT file (or stored in the MIDI chunk of an XM file)
+type MIDIConfig struct {
+	Global [9]MIDIMacro   // indexed by the MIDIGlobal values
+	SFx    [16]MIDIMacro  // parameterized macros, selected with the SFx effect and sent with Zxx (00-7F)
+	Zxx    [128]MIDIMacro // fixed macros, sent with Zxx (80-FF)
+}
@@ -0,0 +1,38 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMIDIMacroEvaluate(t *testing.T) {
+	params := MIDIMacroParams{Channel: 3, Note: 60, Velocity: 100, Z: 0x40}
+
+	for _, tc := range []struct {
+		macro    string
+		params   MIDIMacroParams
+		expected []byte
+	}{
+		{"", params, nil},
+		{"F0F000z", params, []byte{0xF0, 0xF0, 0x00, 0x40}},
+		{"9c n v", params, []byte{0x93, 60, 100}},
+		{"8cnv", params, []byte{0x83, 60, 100}},
+		// only the low nibble of the channel is used
+		{"Bc", MIDIMacroParams{Channel: 0x1F}, []byte{0xBF}},
+		// whole byte values are masked to 7 bits
+		{"9c n v", MIDIMacroParams{Note: 0x80, Velocity: 0xFF}, []byte{0x90, 0x00, 0x7F}},
+		{"z", MIDIMacroParams{Z: 0xC1}, []byte{0x41}},
+		// a lone digit is sent as a byte of its own
+		{"Fz", params, []byte{0x0F, 0x40}},
+		{"F0F", params, []byte{0xF0, 0x0F}},
+		// only uppercase letters are digits, and spaces are ignored
+		{"ab12", params, []byte{0x12}},
+		{"A B C D E F", params, []byte{0xAB, 0xCD, 0xEF}},
+	} {
+		var m MIDIMacro
+		copy(m[:], tc.macro)
+		if out := m.Evaluate(tc.params); !bytes.Equal(out, tc.expected) {
+			t.Errorf("%q: unexpected MIDI data % x", tc.macro, out)
+		}
+	}
+}
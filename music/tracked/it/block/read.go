@@ -0,0 +1,281 @@
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Read reads the block at the start of `data` into the block type matching its identifier
+// Blocks with an identifier that isn't recognized are read as Unknown blocks.
+func Read(data []byte) (Block, error) {
+	if len(data) < 4 {
+		return nil, io.EOF
+	}
+	r := bytes.NewBuffer(data)
+
+	var blockID uint32
+	if err := binary.Read(r, binary.BigEndian, &blockID); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case blockID == 0x504E414D: // PNAM
+		return readBlockPNAM(data)
+	case blockID == 0x434E414D: // CNAM
+		return readBlockCNAM(data)
+	case blockID == 0x43484658: // CHFX
+		return readBlockCHFX(data)
+	case blockID>>16 == 0x4658: // FX__
+		return readBlockFX00(data)
+	default:
+		return readBlockUnknown(data)
+	}
+}
+
+func readBlockPNAM(data []byte) (Block, error) {
+	p := PatternNames{}
+
+	r := bytes.NewBuffer(data)
+
+	if err := binary.Read(r, binary.LittleEndian, &p.Identifier); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.BlockLen); err != nil {
+		return nil, err
+	}
+
+	var nam PatternName
+	cNameLen := len(nam)
+
+	for pos := uint32(0); pos < p.BlockLen; {
+		nlen := int(p.BlockLen - pos)
+		if nlen > cNameLen {
+			nlen = cNameLen
+		}
+		n := make([]byte, nlen)
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		for len(n) < cNameLen {
+			n = append(n, 0)
+		}
+		copy(nam[:], n)
+		p.Name = append(p.Name, nam)
+		pos += uint32(nlen)
+	}
+
+	return &p, nil
+}
+
+func readBlockCNAM(data []byte) (Block, error) {
+	p := ChannelNames{}
+
+	r := bytes.NewBuffer(data)
+
+	if err := binary.Read(r, binary.LittleEndian, &p.Identifier); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.BlockLen); err != nil {
+		return nil, err
+	}
+
+	var nam ChannelName
+	cNameLen := len(nam)
+
+	for pos := uint32(0); pos < p.BlockLen; {
+		nlen := int(p.BlockLen - pos)
+		if nlen > cNameLen {
+			nlen = cNameLen
+		}
+		n := make([]byte, nlen)
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		for len(n) < cNameLen {
+			n = append(n, 0)
+		}
+		copy(nam[:], n)
+		p.Name = append(p.Name, nam)
+		pos += uint32(nlen)
+	}
+
+	return &p, nil
+}
+
+func readBlockCHFX(data []byte) (Block, error) {
+	p := ChannelPlugins{}
+
+	r := bytes.NewBuffer(data)
+
+	if err := binary.Read(r, binary.LittleEndian, &p.Identifier); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.BlockLen); err != nil {
+		return nil, err
+	}
+
+	p.Plugin = make([]uint32, int(p.BlockLen/4))
+	if err := binary.Read(r, binary.LittleEndian, &p.Plugin); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func readBlockFX00(data []byte) (Block, error) {
+	p := FX{}
+
+	r := bytes.NewBuffer(data)
+
+	if err := binary.Read(r, binary.LittleEndian, &p.Identifier); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.BlockLen); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.PluginType); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.UniqueID); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.RoutingFlags); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.MixMode); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.GainFactor); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.Reserved0B); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.OutputRouting); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.Reserved10); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.UserPluginName); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.LibraryName); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.DataLength); err != nil {
+		return nil, err
+	}
+
+	p.Data = make([]byte, int(p.DataLength))
+	if err := binary.Read(r, binary.LittleEndian, &p.Data); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func readBlockUnknown(data []byte) (Block, error) {
+	p := Unknown{}
+
+	r := bytes.NewBuffer(data)
+
+	if err := binary.Read(r, binary.LittleEndian, &p.Identifier); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.BlockLen); err != nil {
+		return nil, err
+	}
+
+	if p.Length() > len(data) {
+		return nil, io.EOF
+	}
+
+	p.Data = make([]byte, int(p.BlockLen))
+	if err := binary.Read(r, binary.LittleEndian, &p.Data); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+const (
+	// extensionFieldHeaderLen is the size of the code and size of each field of the XTPM and STPM blocks
+	extensionFieldHeaderLen = 4 + 2
+)
+
+// ReadExtensions reads the XTPM and STPM blocks that OpenMPT writes at the start of `data`, after the sample data
+// Fields are read for as long as they fit into the data, and the number of bytes read is returned.
+func ReadExtensions(data []byte, numInstruments int) ([]Block, int) {
+	var blocks []Block
+	pos := 0
+
+	if pos+4 <= len(data) && string(data[pos:pos+4]) == "XTPM" {
+		p := ExtendedInstrumentProperties{}
+		copy(p.Identifier[:], data[pos:])
+		pos += 4
+
+		for pos+extensionFieldHeaderLen <= len(data) && string(data[pos:pos+4]) != "STPM" {
+			code := FieldCode(binary.LittleEndian.Uint32(data[pos:]))
+			size := binary.LittleEndian.Uint16(data[pos+4:])
+			end := pos + extensionFieldHeaderLen + int(size)*numInstruments
+			if end > len(data) {
+				break
+			}
+
+			field := InstrumentField{
+				Code: code,
+				Size: size,
+			}
+			for i := pos + extensionFieldHeaderLen; i < end; i += int(size) {
+				field.Values = append(field.Values, append([]byte{}, data[i:i+int(size)]...))
+			}
+			p.Fields = append(p.Fields, field)
+			pos = end
+		}
+
+		blocks = append(blocks, &p)
+	}
+
+	if pos+4 <= len(data) && string(data[pos:pos+4]) == "STPM" {
+		p := SongProperties{}
+		copy(p.Identifier[:], data[pos:])
+		pos += 4
+
+		for pos+extensionFieldHeaderLen <= len(data) {
+			code := FieldCode(binary.LittleEndian.Uint32(data[pos:]))
+			size := binary.LittleEndian.Uint16(data[pos+4:])
+			end := pos + extensionFieldHeaderLen + int(size)
+			if end > len(data) {
+				break
+			}
+
+			p.Fields = append(p.Fields, SongField{
+				Code: code,
+				Data: append([]byte{}, data[pos+extensionFieldHeaderLen:end]...),
+			})
+			pos = end
+		}
+
+		blocks = append(blocks, &p)
+	}
+
+	return blocks, pos
+}
@@ -0,0 +1,93 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testExtensions are XTPM and STPM blocks for two instruments, as OpenMPT writes them
+// The field codes are stored as little-endian values, so "MiP." is stored as ".PiM".
+var testExtensions = []byte(
+	"XTPM" +
+		// MiP.: instrument 2 is routed to plugin 1
+		".PiM\x01\x00" + "\x00\x01" +
+		// CS.. and RS..: instrument 1 has a cutoff swing of 25 and a resonance swing of 50
+		"..SC\x01\x00" + "\x19\x00" +
+		"..SR\x01\x00" + "\x32\x00" +
+		// VR..: volume ramping, which isn't parsed
+		"..RV\x02\x00" + "\x00\x00\x10\x00" +
+		"STPM" +
+		// TM..: modern tempo mode
+		"..MT\x01\x00" + "\x02" +
+		// RPB. and RPM.: 4 rows per beat, 16 rows per measure
+		".BPR\x04\x00" + "\x04\x00\x00\x00" +
+		".MPR\x04\x00" + "\x10\x00\x00\x00" +
+		// PMM.: compatible mixing levels
+		".MMP\x04\x00" + "\x04\x00\x00\x00" +
+		// CWV.: the version of OpenMPT the file was created with, which isn't parsed
+		".VWC\x04\x00" + "\x00\x00\x1F\x01",
+)
+
+func TestReadExtensions(t *testing.T) {
+	blocks, n := ReadExtensions(testExtensions, 2)
+	if n != len(testExtensions) {
+		t.Errorf("%d bytes used instead of %d", n, len(testExtensions))
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("unexpected number of blocks %d", len(blocks))
+	}
+
+	xtpm, ok := blocks[0].(*ExtendedInstrumentProperties)
+	if !ok {
+		t.Fatalf("unexpected block type %T", blocks[0])
+	}
+	if len(xtpm.Fields) != 4 || xtpm.Fields[0].Code.String() != "MiP." {
+		t.Errorf("unexpected fields %+v", xtpm.Fields)
+	}
+	if v, ok := xtpm.MixPlugin(1); !ok || v != 1 {
+		t.Errorf("unexpected mix plugin %d (%v)", v, ok)
+	}
+	if v, ok := xtpm.CutoffSwing(0); !ok || v != 25 {
+		t.Errorf("unexpected cutoff swing %d (%v)", v, ok)
+	}
+	if v, ok := xtpm.ResonanceSwing(0); !ok || v != 50 {
+		t.Errorf("unexpected resonance swing %d (%v)", v, ok)
+	}
+	if _, ok := xtpm.MixPlugin(2); ok {
+		t.Error("unexpected mix plugin for an instrument that doesn't exist")
+	}
+
+	stpm, ok := blocks[1].(*SongProperties)
+	if !ok {
+		t.Fatalf("unexpected block type %T", blocks[1])
+	}
+	if v, ok := stpm.TempoMode(); !ok || v != TempoModeModern {
+		t.Errorf("unexpected tempo mode %d (%v)", v, ok)
+	}
+	if v, ok := stpm.RowsPerBeat(); !ok || v != 4 {
+		t.Errorf("unexpected rows per beat %d (%v)", v, ok)
+	}
+	if v, ok := stpm.RowsPerMeasure(); !ok || v != 16 {
+		t.Errorf("unexpected rows per measure %d (%v)", v, ok)
+	}
+	if v, ok := stpm.MixLevels(); !ok || v != MixLevelsCompatible {
+		t.Errorf("unexpected mix levels %d (%v)", v, ok)
+	}
+	if v, ok := stpm.Value(FieldCode(0x4357562E)); !ok || v != 0x011F0000 {
+		t.Errorf("unexpected value %#x (%v) of an unparsed field", v, ok)
+	}
+
+	// all of the fields are written back, whether they are parsed or not
+	out := &bytes.Buffer{}
+	for _, b := range blocks {
+		if err := Write(out, b, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(out.Bytes(), testExtensions) {
+		t.Errorf("written blocks do not match the original\n% x", out.Bytes())
+	}
+	if l := blocks[0].Length() + blocks[1].Length(); l != len(testExtensions) {
+		t.Errorf("unexpected block lengths %d", l)
+	}
+}
@@ -0,0 +1,103 @@
+package block
+
+const (
+	// SongFieldTempoMode is the tempo mode of the song (see TempoMode)
+	SongFieldTempoMode = FieldCode(0x544D2E2E) // TM..
+	// SongFieldRowsPerBeat is the number of rows per beat
+	SongFieldRowsPerBeat = FieldCode(0x5250422E) // RPB.
+	// SongFieldRowsPerMeasure is the number of rows per measure
+	SongFieldRowsPerMeasure = FieldCode(0x52504D2E) // RPM.
+	// SongFieldMixLevels is the mixing levels of the song (see MixLevels)
+	SongFieldMixLevels = FieldCode(0x504D4D2E) // PMM.
+)
+
+// TempoMode is the way the tempo of a song is interpreted
+type TempoMode uint8
+
+const (
+	// TempoModeClassic is the tempo mode of the classic trackers
+	TempoModeClassic = TempoMode(iota)
+	// TempoModeAlternative is the tempo mode where the tempo is the number of ticks per second
+	TempoModeAlternative
+	// TempoModeModern is the tempo mode where the tempo is the number of beats per minute
+	TempoModeModern
+)
+
+// MixLevels is the set of mixing levels used when playing a song
+type MixLevels uint8
+
+const (
+	// MixLevelsOriginal is the mixing levels of the original ModPlug Tracker
+	MixLevelsOriginal = MixLevels(iota)
+	// MixLevels117RC1 is the mixing levels of OpenMPT 1.17RC1
+	MixLevels117RC1
+	// MixLevels117RC2 is the mixing levels of OpenMPT 1.17RC2
+	MixLevels117RC2
+	// MixLevels117RC3 is the mixing levels of OpenMPT 1.17RC3
+	MixLevels117RC3
+	// MixLevelsCompatible is the mixing levels compatible with other trackers
+	MixLevelsCompatible
+	// MixLevelsCompatibleFT2 is the mixing levels compatible with other trackers, with FastTracker 2 panning
+	MixLevelsCompatibleFT2
+)
+
+// SongField is a single field of the STPM block
+type SongField struct {
+	Code FieldCode
+	Data []byte
+}
+
+// SongProperties is an STPM block, which OpenMPT writes after the XTPM block
+// Unlike the other blocks, it has no length: it holds fields until the end of the file.
+type SongProperties struct {
+	Identifier BlockIdent
+	Fields     []SongField
+}
+
+// FourCC returns the big-endian representation of the block identifier
+func (b *SongProperties) FourCC() uint32 {
+	return b.Identifier.FourCC()
+}
+
+// Length returns the size of the whole block
+func (b *SongProperties) Length() int {
+	n := 4
+	for _, f := range b.Fields {
+		n += 4 + 2 + len(f.Data)
+	}
+	return n
+}
+
+// Value returns the value of the field with the code `code`
+func (b *SongProperties) Value(code FieldCode) (uint64, bool) {
+	for _, f := range b.Fields {
+		if f.Code == code {
+			return fieldValue(f.Data), true
+		}
+	}
+	return 0, false
+}
+
+// TempoMode returns the tempo mode of the song
+func (b *SongProperties) TempoMode() (TempoMode, bool) {
+	v, ok := b.Value(SongFieldTempoMode)
+	return TempoMode(v), ok
+}
+
+// RowsPerBeat returns the number of rows per beat
+func (b *SongProperties) RowsPerBeat() (uint32, bool) {
+	v, ok := b.Value(SongFieldRowsPerBeat)
+	return uint32(v), ok
+}
+
+// RowsPerMeasure returns the number of rows per measure
+func (b *SongProperties) RowsPerMeasure() (uint32, bool) {
+	v, ok := b.Value(SongFieldRowsPerMeasure)
+	return uint32(v), ok
+}
+
+// MixLevels returns the mixing levels of the song
+func (b *SongProperties) MixLevels() (MixLevels, bool) {
+	v, ok := b.Value(SongFieldMixLevels)
+	return MixLevels(v), ok
+}
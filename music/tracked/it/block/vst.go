@@ -0,0 +1,255 @@
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/gotracker/goaudiofile/internal/util"
+)
+
+var (
+	// ErrNotVST is for when VST data is requested from a plugin that is not a VST plugin
+	ErrNotVST = errors.New("plugin is not a VST plugin")
+	// ErrInvalidFXP is for when an fxp program in the plugin data is cut short
+	ErrInvalidFXP = errors.New("invalid fxp program data")
+	// ErrUnknownPluginDataType is for when the plugin data does not start with a known data type tag
+	ErrUnknownPluginDataType = errors.New("unknown plugin data type")
+	// ErrInvalidParameterList is for when the parameter list in the plugin data holds a partial value
+	ErrInvalidParameterList = errors.New("invalid plugin parameter list")
+)
+
+// VSTDataFormat is the way the plugin data of a VST plugin is stored
+type VSTDataFormat uint8
+
+const (
+	// VSTDataFormatParameters is a plain list of (little-endian) parameter values
+	VSTDataFormatParameters = VSTDataFormat(iota)
+	// VSTDataFormatFXPParameters is a chunk holding an fxp program ("CcnK"/"FxCk") with a list of (big-endian) parameter values
+	VSTDataFormatFXPParameters
+	// VSTDataFormatFXPChunk is a chunk holding an fxp program ("CcnK"/"FPCh") with an opaque chunk
+	VSTDataFormatFXPChunk
+	// VSTDataFormatChunk is an opaque chunk that only the plugin itself understands
+	VSTDataFormatChunk
+)
+
+const (
+	// fxpHeaderLen is the size of an fxp program up to (and including) the program name
+	fxpHeaderLen = 4 + 4 + 4 + 4 + 4 + 4 + 4 + 28
+)
+
+// VSTProgramName is the name of a VST program
+type VSTProgramName [28]byte
+
+func (n VSTProgramName) String() string {
+	return util.GetString(n[:])
+}
+
+// VSTData is the decoded plugin data of a VST plugin
+type VSTData struct {
+	Format      VSTDataFormat
+	Version     uint32         // fxp only: the version of the fxp format
+	PluginID    [4]byte        // fxp only: the unique ID of the plugin
+	FXVersion   uint32         // fxp only: the version of the plugin
+	NumParams   uint32         // fxp only: the number of parameters of the plugin (for parameter lists, this matches Parameters)
+	ProgramName VSTProgramName // fxp only
+	Parameters  []float32      // the parameter values, when the format holds parameters
+	Chunk       []byte         // the opaque chunk, when the format holds a chunk
+}
+
+// VSTData decodes the plugin data of a VST plugin
+// The data starts with a data type tag: 0 for a parameter list, or "fEvN" for a chunk, which is treated as
+// an fxp program if it starts with "CcnK" and as an opaque chunk otherwise.
+func (b *FX) VSTData() (*VSTData, error) {
+	if b.PluginType != PluginTypeVST {
+		return nil, ErrNotVST
+	}
+	return DecodeVSTData(b.Data)
+}
+
+// SetVSTData encodes the VST plugin data `d` into the plugin data
+func (b *FX) SetVSTData(d *VSTData) error {
+	data, err := d.Encode()
+	if err != nil {
+		return err
+	}
+
+	b.PluginType = PluginTypeVST
+	b.Data = data
+	b.DataLength = uint32(len(data))
+	return nil
+}
+
+// DecodeVSTData decodes the plugin data `data` of a VST plugin
+func DecodeVSTData(data []byte) (*VSTData, error) {
+	if len(data) == 0 {
+		// nothing was saved
+		return &VSTData{
+			Format: VSTDataFormatParameters,
+		}, nil
+	}
+
+	if len(data) < pluginDataTypeLen {
+		return nil, ErrUnknownPluginDataType
+	}
+
+	payload := data[pluginDataTypeLen:]
+	switch {
+	case binary.LittleEndian.Uint32(data) == pluginDataTypeParameters:
+		if len(payload)%4 != 0 {
+			return nil, ErrInvalidParameterList
+		}
+
+		d := VSTData{
+			Format:     VSTDataFormatParameters,
+			Parameters: make([]float32, len(payload)/4),
+		}
+		for i := range d.Parameters {
+			d.Parameters[i] = math.Float32frombits(binary.LittleEndian.Uint32(payload[i*4:]))
+		}
+		return &d, nil
+
+	case string(data[:pluginDataTypeLen]) == pluginDataTypeChunk:
+		if len(payload) >= 4 && string(payload[:4]) == "CcnK" {
+			return decodeFXP(payload)
+		}
+		return &VSTData{
+			Format: VSTDataFormatChunk,
+			Chunk:  append([]byte{}, payload...),
+		}, nil
+
+	default:
+		return nil, ErrUnknownPluginDataType
+	}
+}
+
+func decodeFXP(data []byte) (*VSTData, error) {
+	if len(data) < fxpHeaderLen {
+		return nil, ErrInvalidFXP
+	}
+
+	r := bytes.NewReader(data[8:])
+	var fxMagic [4]byte
+	if err := binary.Read(r, binary.BigEndian, &fxMagic); err != nil {
+		return nil, err
+	}
+
+	d := VSTData{}
+	switch string(fxMagic[:]) {
+	case "FxCk":
+		d.Format = VSTDataFormatFXPParameters
+	case "FPCh":
+		d.Format = VSTDataFormatFXPChunk
+	default:
+		// banks (and anything else) are kept as they are
+		return &VSTData{
+			Format: VSTDataFormatChunk,
+			Chunk:  append([]byte{}, data...),
+		}, nil
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &d.Version); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &d.PluginID); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &d.FXVersion); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &d.NumParams); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &d.ProgramName); err != nil {
+		return nil, err
+	}
+
+	if d.Format == VSTDataFormatFXPParameters {
+		if uint64(d.NumParams)*4 > uint64(r.Len()) {
+			return nil, ErrInvalidFXP
+		}
+		d.Parameters = make([]float32, int(d.NumParams))
+		if err := binary.Read(r, binary.BigEndian, &d.Parameters); err != nil {
+			return nil, err
+		}
+		return &d, nil
+	}
+
+	var chunkSize uint32
+	if err := binary.Read(r, binary.BigEndian, &chunkSize); err != nil {
+		return nil, ErrInvalidFXP
+	}
+	if uint64(chunkSize) > uint64(r.Len()) {
+		return nil, ErrInvalidFXP
+	}
+	d.Chunk = make([]byte, int(chunkSize))
+	if err := binary.Read(r, binary.BigEndian, &d.Chunk); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Encode converts the VST plugin data into plugin data bytes, starting with the data type tag
+func (d *VSTData) Encode() ([]byte, error) {
+	switch d.Format {
+	case VSTDataFormatParameters:
+		buf := &bytes.Buffer{}
+		if err := binary.Write(buf, binary.LittleEndian, pluginDataTypeParameters); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(buf, binary.LittleEndian, d.Parameters); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case VSTDataFormatChunk:
+		return append([]byte(pluginDataTypeChunk), d.Chunk...), nil
+
+	case VSTDataFormatFXPParameters, VSTDataFormatFXPChunk:
+		body := &bytes.Buffer{}
+		fxMagic, numParams := "FxCk", uint32(len(d.Parameters))
+		if d.Format == VSTDataFormatFXPChunk {
+			fxMagic, numParams = "FPCh", d.NumParams
+		}
+		body.WriteString(fxMagic)
+		for _, v := range []interface{}{
+			d.Version,
+			d.PluginID,
+			d.FXVersion,
+			numParams,
+			d.ProgramName,
+		} {
+			if err := binary.Write(body, binary.BigEndian, v); err != nil {
+				return nil, err
+			}
+		}
+
+		if d.Format == VSTDataFormatFXPParameters {
+			if err := binary.Write(body, binary.BigEndian, d.Parameters); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := binary.Write(body, binary.BigEndian, uint32(len(d.Chunk))); err != nil {
+				return nil, err
+			}
+			body.Write(d.Chunk)
+		}
+
+		out := &bytes.Buffer{}
+		out.WriteString(pluginDataTypeChunk)
+		out.WriteString("CcnK")
+		if err := binary.Write(out, binary.BigEndian, uint32(body.Len())); err != nil {
+			return nil, err
+		}
+		out.Write(body.Bytes())
+		return out.Bytes(), nil
+
+	default:
+		return nil, errors.New("unknown VST data format")
+	}
+}
@@ -0,0 +1,103 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeVSTDataParameters(t *testing.T) {
+	data := []byte{
+		0x00, 0x00, 0x00, 0x00, // data type
+		0x00, 0x00, 0x00, 0x3F, // 0.5
+		0x00, 0x00, 0x80, 0x3F, // 1.0
+	}
+
+	d, err := DecodeVSTData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Format != VSTDataFormatParameters {
+		t.Fatalf("unexpected format %d", d.Format)
+	}
+	if len(d.Parameters) != 2 || d.Parameters[0] != 0.5 || d.Parameters[1] != 1 {
+		t.Errorf("unexpected parameters %v", d.Parameters)
+	}
+
+	out, err := d.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("unexpected plugin data % x", out)
+	}
+}
+
+func TestDecodeVSTDataChunk(t *testing.T) {
+	// the chunk length is a multiple of 4, but it's still a chunk
+	data := append([]byte("fEvN"), 1, 2, 3, 4, 5, 6, 7, 8)
+
+	d, err := DecodeVSTData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Format != VSTDataFormatChunk {
+		t.Fatalf("unexpected format %d", d.Format)
+	}
+	if !bytes.Equal(d.Chunk, data[4:]) {
+		t.Errorf("unexpected chunk % x", d.Chunk)
+	}
+
+	out, err := d.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("unexpected plugin data % x", out)
+	}
+}
+
+func TestDecodeVSTDataFXP(t *testing.T) {
+	fxp := []byte("CcnK")
+	fxp = append(fxp, 0x00, 0x00, 0x00, 0x34) // byte size
+	fxp = append(fxp, "FxCk"...)
+	fxp = append(fxp, 0x00, 0x00, 0x00, 0x01) // version
+	fxp = append(fxp, "Abcd"...)              // plugin ID
+	fxp = append(fxp, 0x00, 0x00, 0x00, 0x02) // plugin version
+	fxp = append(fxp, 0x00, 0x00, 0x00, 0x01) // number of parameters
+	name := make([]byte, 28)
+	copy(name, "Init")
+	fxp = append(fxp, name...)
+	fxp = append(fxp, 0x3F, 0x00, 0x00, 0x00) // 0.5
+	data := append([]byte("fEvN"), fxp...)
+
+	d, err := DecodeVSTData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Format != VSTDataFormatFXPParameters {
+		t.Fatalf("unexpected format %d", d.Format)
+	}
+	if string(d.PluginID[:]) != "Abcd" || d.ProgramName.String() != "Init" {
+		t.Errorf("unexpected program %q %q", d.PluginID, d.ProgramName.String())
+	}
+	if len(d.Parameters) != 1 || d.Parameters[0] != 0.5 {
+		t.Errorf("unexpected parameters %v", d.Parameters)
+	}
+
+	out, err := d.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("unexpected plugin data % x", out)
+	}
+}
+
+func TestDecodeVSTDataUnknownType(t *testing.T) {
+	if _, err := DecodeVSTData([]byte{1, 2, 3, 4, 5, 6, 7, 8}); err != ErrUnknownPluginDataType {
+		t.Errorf("expected ErrUnknownPluginDataType, got %v", err)
+	}
+}
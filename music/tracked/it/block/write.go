@@ -0,0 +1,267 @@
+package block
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Write writes the block `b` to the output stream
+// When `keepLen` is set, the original block length is kept and only the parts of the block that
+// the reader retains are written, leaving the rest to be filled in by the caller
+func Write(w io.Writer, b Block, keepLen bool) error {
+	switch p := b.(type) {
+	case *PatternNames:
+		return writeBlockPNAM(w, p, keepLen)
+	case *ChannelNames:
+		return writeBlockCNAM(w, p, keepLen)
+	case *ChannelPlugins:
+		return writeBlockCHFX(w, p, keepLen)
+	case *FX:
+		return writeBlockFX00(w, p, keepLen)
+	case *Unknown:
+		return writeBlockUnknown(w, p, keepLen)
+	case *ExtendedInstrumentProperties:
+		return writeBlockXTPM(w, p)
+	case *SongProperties:
+		return writeBlockSTPM(w, p)
+	default:
+		return errors.New("unsupported block type")
+	}
+}
+
+// ParsedLength returns the number of bytes of the block (including its header) that Read retains
+func ParsedLength(b Block) int {
+	switch p := b.(type) {
+	case *ChannelPlugins:
+		return 8 + len(p.Plugin)*4
+	case *FX:
+		return 8 + fxHeaderLen + len(p.Data)
+	default:
+		return b.Length()
+	}
+}
+
+const (
+	// fxHeaderLen is the size of everything in a FX__ block from the plugin type up to (and including) the data length
+	fxHeaderLen = 4 + 4 + 1 + 1 + 1 + 1 + 4 + 16 + 32 + 64 + 4
+)
+
+func writeBlockPNAM(w io.Writer, p *PatternNames, keepLen bool) error {
+	var nam PatternName
+	blockLen := uint32(len(p.Name) * len(nam))
+	if keepLen {
+		blockLen = p.BlockLen
+	}
+
+	names := &bytes.Buffer{}
+	if err := binary.Write(names, binary.LittleEndian, p.Name); err != nil {
+		return err
+	}
+	// the last name may be cut short
+	names.Truncate(int(blockLen))
+
+	if err := binary.Write(w, binary.LittleEndian, p.Identifier); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, blockLen); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(names.Bytes()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeBlockCNAM(w io.Writer, p *ChannelNames, keepLen bool) error {
+	var nam ChannelName
+	blockLen := uint32(len(p.Name) * len(nam))
+	if keepLen {
+		blockLen = p.BlockLen
+	}
+
+	names := &bytes.Buffer{}
+	if err := binary.Write(names, binary.LittleEndian, p.Name); err != nil {
+		return err
+	}
+	// the last name may be cut short
+	names.Truncate(int(blockLen))
+
+	if err := binary.Write(w, binary.LittleEndian, p.Identifier); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, blockLen); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(names.Bytes()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeBlockCHFX(w io.Writer, p *ChannelPlugins, keepLen bool) error {
+	blockLen := uint32(len(p.Plugin) * 4)
+	if keepLen && p.BlockLen > blockLen {
+		blockLen = p.BlockLen
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Identifier); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, blockLen); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Plugin); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeBlockFX00(w io.Writer, p *FX, keepLen bool) error {
+	blockLen := uint32(fxHeaderLen + len(p.Data))
+	if keepLen && p.BlockLen > blockLen {
+		blockLen = p.BlockLen
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Identifier); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, blockLen); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.PluginType); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.UniqueID); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.RoutingFlags); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.MixMode); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.GainFactor); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Reserved0B); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.OutputRouting); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Reserved10); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.UserPluginName); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.LibraryName); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(p.Data))); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(p.Data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeBlockUnknown(w io.Writer, p *Unknown, keepLen bool) error {
+	blockLen := uint32(len(p.Data))
+	if keepLen && p.BlockLen > blockLen {
+		blockLen = p.BlockLen
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Identifier); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, blockLen); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(p.Data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func writeBlockXTPM(w io.Writer, p *ExtendedInstrumentProperties) error {
+	if err := binary.Write(w, binary.LittleEndian, p.Identifier); err != nil {
+		return err
+	}
+
+	for _, f := range p.Fields {
+		if err := binary.Write(w, binary.LittleEndian, f.Code); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, f.Size); err != nil {
+			return err
+		}
+
+		for _, v := range f.Values {
+			if len(v) != int(f.Size) {
+				return errors.New("XTPM field value does not match the field size")
+			}
+			if _, err := w.Write(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeBlockSTPM(w io.Writer, p *SongProperties) error {
+	if err := binary.Write(w, binary.LittleEndian, p.Identifier); err != nil {
+		return err
+	}
+
+	for _, f := range p.Fields {
+		if len(f.Data) > 0xFFFF {
+			return errors.New("STPM field is too long")
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, f.Code); err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.LittleEndian, uint16(len(f.Data))); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(f.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
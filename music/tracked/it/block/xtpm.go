@@ -0,0 +1,70 @@
+package block
+
+const (
+	// InstrumentFieldMixPlugin is the plugin the instrument is routed to (0 = none, otherwise the 1-based plugin number)
+	InstrumentFieldMixPlugin = FieldCode(0x4D69502E) // MiP.
+	// InstrumentFieldCutoffSwing is the random variation of the instrument's filter cutoff (0-100%)
+	InstrumentFieldCutoffSwing = FieldCode(0x43532E2E) // CS..
+	// InstrumentFieldResonanceSwing is the random variation of the instrument's filter resonance (0-100%)
+	InstrumentFieldResonanceSwing = FieldCode(0x52532E2E) // RS..
+)
+
+// InstrumentField is a single field of the XTPM block, holding a value for every instrument
+type InstrumentField struct {
+	Code   FieldCode
+	Size   uint16   // the size of each value
+	Values [][]byte // one value per instrument
+}
+
+// ExtendedInstrumentProperties is an XTPM block, which OpenMPT writes after the sample data
+// Unlike the other blocks, it has no length: it holds fields until the STPM block (or the end of the file).
+type ExtendedInstrumentProperties struct {
+	Identifier BlockIdent
+	Fields     []InstrumentField
+}
+
+// FourCC returns the big-endian representation of the block identifier
+func (b *ExtendedInstrumentProperties) FourCC() uint32 {
+	return b.Identifier.FourCC()
+}
+
+// Length returns the size of the whole block
+func (b *ExtendedInstrumentProperties) Length() int {
+	n := 4
+	for _, f := range b.Fields {
+		n += 4 + 2 + int(f.Size)*len(f.Values)
+	}
+	return n
+}
+
+// Value returns the value of the field with the code `code` for the instrument `inst` (0-based)
+func (b *ExtendedInstrumentProperties) Value(code FieldCode, inst int) (uint64, bool) {
+	for _, f := range b.Fields {
+		if f.Code != code {
+			continue
+		}
+		if inst < 0 || inst >= len(f.Values) {
+			return 0, false
+		}
+		return fieldValue(f.Values[inst]), true
+	}
+	return 0, false
+}
+
+// MixPlugin returns the plugin the instrument `inst` (0-based) is routed to
+func (b *ExtendedInstrumentProperties) MixPlugin(inst int) (uint8, bool) {
+	v, ok := b.Value(InstrumentFieldMixPlugin, inst)
+	return uint8(v), ok
+}
+
+// CutoffSwing returns the filter cutoff swing of the instrument `inst` (0-based)
+func (b *ExtendedInstrumentProperties) CutoffSwing(inst int) (uint8, bool) {
+	v, ok := b.Value(InstrumentFieldCutoffSwing, inst)
+	return uint8(v), ok
+}
+
+// ResonanceSwing returns the filter resonance swing of the instrument `inst` (0-based)
+func (b *ExtendedInstrumentProperties) ResonanceSwing(inst int) (uint8, bool) {
+	v, ok := b.Value(InstrumentFieldResonanceSwing, inst)
+	return uint8(v), ok
+}
@@ -0,0 +1,211 @@
+package it
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// compressedBlockFrames8Bit is the number of 8-bit samples encoded in each compressed block
+	compressedBlockFrames8Bit = 0x8000
+	// compressedBlockFrames16Bit is the number of 16-bit samples encoded in each compressed block
+	compressedBlockFrames16Bit = 0x4000
+)
+
+// bitReader reads values from a compressed block, least significant bit first
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (b *bitReader) readBits(n uint8) (uint32, bool) {
+	var v uint32
+	for i := uint8(0); i < n; i++ {
+		idx := b.pos >> 3
+		if idx >= len(b.data) {
+			return 0, false
+		}
+		v |= uint32((b.data[idx]>>(b.pos&7))&1) << i
+		b.pos++
+	}
+	return v, true
+}
+
+// decompressSample decodes `frames` samples of a single channel of IT 2.14 (or, if `it215` is set, IT 2.15)
+// compressed sample data from `data` into `out` as signed PCM
+// It returns the number of bytes of `data` that were consumed. Data that ends early leaves the rest of `out` silent.
+func decompressSample(data []byte, frames int, is16Bit bool, it215 bool, out []byte) int {
+	if is16Bit {
+		return decompress16Bit(data, frames, it215, out)
+	}
+	return decompress8Bit(data, frames, it215, out)
+}
+
+// nextCompressedBlock returns the contents of the compressed block starting at `pos`
+func nextCompressedBlock(data []byte, pos int) ([]byte, int, bool) {
+	if pos+2 > len(data) {
+		return nil, pos, false
+	}
+	blockLen := int(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	end := pos + blockLen
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[pos:end], end, true
+}
+
+func decompress8Bit(data []byte, frames int, it215 bool, out []byte) int {
+	pos := 0
+	for i := 0; i < frames; {
+		block, next, ok := nextCompressedBlock(data, pos)
+		if !ok {
+			break
+		}
+		pos = next
+
+		blockFrames := frames - i
+		if blockFrames > compressedBlockFrames8Bit {
+			blockFrames = compressedBlockFrames8Bit
+		}
+
+		br := bitReader{data: block}
+		width := uint8(9)
+		var d1, d2 int8
+		for n := 0; n < blockFrames; {
+			value, ok := br.readBits(width)
+			if !ok {
+				return pos
+			}
+
+			switch {
+			case width == 0 || width > 9:
+				// illegal width, the rest of the data can't be trusted
+				return pos
+			case width < 7:
+				// method 1: a single marker value, followed by the new width
+				if value == 1<<(width-1) {
+					v, ok := br.readBits(3)
+					if !ok {
+						return pos
+					}
+					width = changeWidth(uint8(v)+1, width)
+					continue
+				}
+			case width < 9:
+				// method 2: a range of values at the top of the width
+				border := (uint32(0xFF) >> (9 - width)) - 4
+				if value > border && value <= border+8 {
+					width = changeWidth(uint8(value-border), width)
+					continue
+				}
+			default:
+				// method 3: the high bit is set
+				if value&0x100 != 0 {
+					width = uint8(value+1) & 0xFF
+					continue
+				}
+			}
+
+			var v int8
+			if width < 8 {
+				shift := 8 - width
+				v = int8(uint8(value)<<shift) >> shift
+			} else {
+				v = int8(value)
+			}
+
+			d1 += v
+			d2 += d1
+			if it215 {
+				out[i+n] = uint8(d2)
+			} else {
+				out[i+n] = uint8(d1)
+			}
+			n++
+		}
+		i += blockFrames
+	}
+	return pos
+}
+
+func decompress16Bit(data []byte, frames int, it215 bool, out []byte) int {
+	pos := 0
+	for i := 0; i < frames; {
+		block, next, ok := nextCompressedBlock(data, pos)
+		if !ok {
+			break
+		}
+		pos = next
+
+		blockFrames := frames - i
+		if blockFrames > compressedBlockFrames16Bit {
+			blockFrames = compressedBlockFrames16Bit
+		}
+
+		br := bitReader{data: block}
+		width := uint8(17)
+		var d1, d2 int16
+		for n := 0; n < blockFrames; {
+			value, ok := br.readBits(width)
+			if !ok {
+				return pos
+			}
+
+			switch {
+			case width == 0 || width > 17:
+				// illegal width, the rest of the data can't be trusted
+				return pos
+			case width < 7:
+				// method 1: a single marker value, followed by the new width
+				if value == 1<<(width-1) {
+					v, ok := br.readBits(4)
+					if !ok {
+						return pos
+					}
+					width = changeWidth(uint8(v)+1, width)
+					continue
+				}
+			case width < 17:
+				// method 2: a range of values at the top of the width
+				border := (uint32(0xFFFF) >> (17 - width)) - 8
+				if value > border && value <= border+16 {
+					width = changeWidth(uint8(value-border), width)
+					continue
+				}
+			default:
+				// method 3: the high bit is set
+				if value&0x10000 != 0 {
+					width = uint8(value+1) & 0xFF
+					continue
+				}
+			}
+
+			var v int16
+			if width < 16 {
+				shift := 16 - width
+				v = int16(uint16(value)<<shift) >> shift
+			} else {
+				v = int16(value)
+			}
+
+			d1 += v
+			d2 += d1
+			s := d1
+			if it215 {
+				s = d2
+			}
+			binary.LittleEndian.PutUint16(out[(i+n)*2:], uint16(s))
+			n++
+		}
+		i += blockFrames
+	}
+	return pos
+}
+
+// changeWidth returns the bit width selected by `v`, skipping over the current width `width`
+func changeWidth(v uint8, width uint8) uint8 {
+	if v < width {
+		return v
+	}
+	return v + 1
+}
@@ -0,0 +1,173 @@
+package it
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// bitWriter writes values into a compressed block, least significant bit first
+type bitWriter struct {
+	data []byte
+	pos  int
+}
+
+func (b *bitWriter) writeBits(v uint32, n uint8) {
+	for i := uint8(0); i < n; i++ {
+		if b.pos>>3 >= len(b.data) {
+			b.data = append(b.data, 0)
+		}
+		b.data[b.pos>>3] |= uint8((v>>i)&1) << (b.pos & 7)
+		b.pos++
+	}
+}
+
+// block returns the written bits as a compressed block, prefixed by its length
+func (b *bitWriter) block() []byte {
+	return append(binary.LittleEndian.AppendUint16(nil, uint16(len(b.data))), b.data...)
+}
+
+// testCompressed8Bit is a block of 5 8-bit values that uses every way of changing the bit width
+func testCompressed8Bit() []byte {
+	b := &bitWriter{}
+	b.writeBits(5, 9)
+	// method 3: the high bit selects width 7
+	b.writeBits(0x100|(7-1), 9)
+	// -3, which has to be sign extended
+	b.writeBits(0x7D, 7)
+	// method 2: border 59 + 3 selects width 3
+	b.writeBits(59+3, 7)
+	// -1 and 3
+	b.writeBits(0x7, 3)
+	b.writeBits(0x3, 3)
+	// method 1: the marker, followed by 6 + 1 selecting width 8 (as width 3 is skipped)
+	b.writeBits(1<<2, 3)
+	b.writeBits(6, 3)
+	// -16
+	b.writeBits(0xF0, 8)
+	return b.block()
+}
+
+// testCompressed16Bit is a block of 5 16-bit values that uses every way of changing the bit width
+func testCompressed16Bit() []byte {
+	b := &bitWriter{}
+	b.writeBits(1000, 17)
+	// method 3: the high bit selects width 12
+	b.writeBits(0x10000|(12-1), 17)
+	// -5, which has to be sign extended
+	b.writeBits(0xFFB, 12)
+	// method 2: border 2039 + 4 selects width 4
+	b.writeBits(2039+4, 12)
+	// 7 and -1
+	b.writeBits(0x7, 4)
+	b.writeBits(0xF, 4)
+	// method 1: the marker, followed by 14 + 1 selecting width 16 (as width 4 is skipped)
+	b.writeBits(1<<3, 4)
+	b.writeBits(14, 4)
+	// -2000
+	b.writeBits(0xF830, 16)
+	return b.block()
+}
+
+func TestDecompressSample(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		is16Bit  bool
+		it215    bool
+		expected []int
+	}{
+		{"IT214 8-bit", testCompressed8Bit(), false, false, []int{5, 2, 1, 4, -12}},
+		{"IT215 8-bit", testCompressed8Bit(), false, true, []int{5, 7, 8, 12, 0}},
+		{"IT214 16-bit", testCompressed16Bit(), true, false, []int{1000, 995, 1002, 1001, -999}},
+		{"IT215 16-bit", testCompressed16Bit(), true, true, []int{1000, 1995, 2997, 3998, 2999}},
+	} {
+		frameSize := 1
+		if tc.is16Bit {
+			frameSize = 2
+		}
+		out := make([]byte, len(tc.expected)*frameSize)
+
+		if n := decompressSample(tc.data, len(tc.expected), tc.is16Bit, tc.it215, out); n != len(tc.data) {
+			t.Errorf("%s: %d bytes used instead of %d", tc.name, n, len(tc.data))
+		}
+		for i, e := range tc.expected {
+			var v int
+			if tc.is16Bit {
+				v = int(int16(binary.LittleEndian.Uint16(out[i*2:])))
+			} else {
+				v = int(int8(out[i]))
+			}
+			if v != e {
+				t.Errorf("%s: unexpected value %d at %d, expected %d", tc.name, v, i, e)
+			}
+		}
+	}
+}
+
+func TestDecompressSampleBlocks(t *testing.T) {
+	// the first block holds 0x8000 values, which leave the delta at 5
+	b := &bitWriter{}
+	b.writeBits(5, 9)
+	for i := 1; i < compressedBlockFrames8Bit; i++ {
+		b.writeBits(0, 9)
+	}
+	data := b.block()
+
+	// the second block starts over from zero
+	b = &bitWriter{}
+	b.writeBits(1, 9)
+	b.writeBits(1, 9)
+	data = append(data, b.block()...)
+
+	out := make([]byte, compressedBlockFrames8Bit+2)
+	if n := decompressSample(data, len(out), false, false, out); n != len(data) {
+		t.Errorf("%d bytes used instead of %d", n, len(data))
+	}
+	if v := out[compressedBlockFrames8Bit-1]; v != 5 {
+		t.Errorf("unexpected last value %d of the first block", v)
+	}
+	if v := out[compressedBlockFrames8Bit:]; !bytes.Equal(v, []byte{1, 2}) {
+		t.Errorf("unexpected values % x of the second block", v)
+	}
+}
+
+func TestDecompressSampleTruncated(t *testing.T) {
+	data := testCompressed8Bit()
+	// cut the last value short
+	data = data[:len(data)-1]
+
+	// the values that can't be decoded are left silent
+	out := make([]byte, 6)
+	decompressSample(data, len(out), false, false, out)
+	if !bytes.Equal(out, []byte{5, 2, 1, 4, 0, 0}) {
+		t.Errorf("unexpected values % x", out)
+	}
+}
+
+func TestReadCompressedStereoSampleData(t *testing.T) {
+	// each channel is compressed on its own, starting with a block of its own
+	left := &bitWriter{}
+	left.writeBits(1, 9)
+	left.writeBits(1, 9)
+	right := &bitWriter{}
+	right.writeBits(0xFF, 9)
+	right.writeBits(0xFF, 9)
+	data := append([]byte{0xEE}, append(left.block(), right.block()...)...)
+
+	hdr := &Sample{
+		Flags:         SampleFlagSampleExists | SampleFlagStereo | SampleFlagCompressed,
+		Length:        2,
+		SamplePointer: 1,
+	}
+	out, n, err := readSampleData(data, hdr, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data)-1 {
+		t.Errorf("%d bytes used instead of %d", n, len(data)-1)
+	}
+	if !bytes.Equal(out, []byte{1, 0xFF, 2, 0xFE}) {
+		t.Errorf("unexpected sample data % x", out)
+	}
+}
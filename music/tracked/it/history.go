@@ -0,0 +1,43 @@
+package it
+
+import "time"
+
+const (
+	// historyEntrySize is the size of a single edit history entry
+	historyEntrySize = 8
+	// dosTimerRate is the rate (in Hz) of the DOS timer used to measure how long the song was edited
+	dosTimerRate = 1193182.0 / 65536.0
+)
+
+// HistoryEntry is a single entry of the edit history, recorded by Impulse Tracker each time the song is saved
+type HistoryEntry struct {
+	FATDate uint16
+	FATTime uint16
+	Runtime uint32 // the number of DOS timer ticks the song was open for
+}
+
+// Time returns the time the edit session was started
+// The FAT date and time have no time zone, so the result is reported in UTC.
+func (h HistoryEntry) Time() time.Time {
+	year := 1980 + int(h.FATDate>>9)
+	month := time.Month((h.FATDate >> 5) & 0x0F)
+	day := int(h.FATDate & 0x1F)
+	hour := int(h.FATTime >> 11)
+	minute := int((h.FATTime >> 5) & 0x3F)
+	second := int(h.FATTime&0x1F) * 2
+	return time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+}
+
+// Duration returns how long the song was open for during the edit session
+func (h HistoryEntry) Duration() time.Duration {
+	return time.Duration(float64(h.Runtime) / dosTimerRate * float64(time.Second))
+}
+
+// TotalEditTime returns the sum of the durations of all of the edit history entries
+func (f *File) TotalEditTime() time.Duration {
+	var total time.Duration
+	for _, h := range f.History {
+		total += h.Duration()
+	}
+	return total
+}
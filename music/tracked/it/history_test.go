@@ -0,0 +1,45 @@
+package it
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHistoryEntry(t *testing.T) {
+	h := HistoryEntry{
+		// 2004-03-15
+		FATDate: 24<<9 | 3<<5 | 15,
+		// 13:45:30, stored in units of 2 seconds
+		FATTime: 13<<11 | 45<<5 | 15,
+		// 65536 seconds' worth of DOS timer ticks
+		Runtime: 1193182,
+	}
+
+	if tm, expected := h.Time(), time.Date(2004, time.March, 15, 13, 45, 30, 0, time.UTC); !tm.Equal(expected) {
+		t.Errorf("unexpected time %v", tm)
+	}
+	if d := h.Duration(); d != 65536*time.Second {
+		t.Errorf("unexpected duration %v", d)
+	}
+}
+
+func TestReadHistory(t *testing.T) {
+	f := newTestFile()
+	f.History = []HistoryEntry{
+		{FATDate: 24<<9 | 3<<5 | 15, FATTime: 13<<11 | 45<<5 | 15, Runtime: 1193182},
+		// 10 seconds
+		{FATDate: 24<<9 | 3<<5 | 16, Runtime: 182},
+	}
+
+	g, err := Read(bytes.NewReader(writeTestFile(t, f)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.History) != 2 || g.History[1] != f.History[1] {
+		t.Fatalf("unexpected history %+v", g.History)
+	}
+	if d := g.TotalEditTime().Round(time.Second); d != (65536+10)*time.Second {
+		t.Errorf("unexpected total edit time %v", d)
+	}
+}
@@ -9,6 +9,11 @@ import (
 	"github.com/gotracker/goaudiofile/internal/util"
 )
 
+const (
+	// impiSize is the size of an IMPI block as written by Impulse Tracker (both layouts)
+	impiSize = 554
+)
+
 var (
 	// ErrInvalidInstrumentFormat is an error for when an invalid instrument format is encountered
 	ErrInvalidInstrumentFormat = errors.New("invalid instrument format")
@@ -17,6 +22,19 @@ var (
 // IMPIIntf is an interface to the IT instruments
 type IMPIIntf interface{}
 
+// NormalizeInstrument returns the instrument `inst` in the modern IMPIInstrument shape,
+// converting old format instruments (see IMPIInstrumentOld.ToIMPIInstrument)
+func NormalizeInstrument(inst IMPIIntf) (*IMPIInstrument, error) {
+	switch ii := inst.(type) {
+	case *IMPIInstrumentOld:
+		return ii.ToIMPIInstrument(), nil
+	case *IMPIInstrument:
+		return ii, nil
+	default:
+		return nil, ErrInvalidInstrumentFormat
+	}
+}
+
 func readIMPI(data []byte, ptr ParaPointer, cmwt uint16) (IMPIIntf, error) {
 	ofs := ptr.Offset()
 	r := bytes.NewBuffer(data[ofs:])
@@ -56,3 +74,20 @@ func readIMPINew(r io.Reader) (*IMPIInstrument, error) {
 
 	return &inst, nil
 }
+
+func writeIMPI(w io.Writer, inst IMPIIntf, cmwt uint16) error {
+	switch ii := inst.(type) {
+	case *IMPIInstrumentOld:
+		if cmwt >= 0x200 {
+			return ErrInvalidInstrumentFormat
+		}
+		return binary.Write(w, binary.LittleEndian, ii)
+	case *IMPIInstrument:
+		if cmwt < 0x200 {
+			return ErrInvalidInstrumentFormat
+		}
+		return binary.Write(w, binary.LittleEndian, ii)
+	default:
+		return ErrInvalidInstrumentFormat
+	}
+}
@@ -12,6 +12,7 @@ type IMPIInstrumentOld struct {
 	VolumeLoopEnd      uint8
 	SustainLoopStart   uint8
 	SustainLoopEnd     uint8
+	Reserved16         [2]uint8
 	Fadeout            uint16
 	NewNoteAction      NewNoteAction
 	DuplicateNoteCheck DuplicateNoteCheck
@@ -34,3 +35,77 @@ func (i *IMPIInstrumentOld) GetName() string {
 func (i *IMPIInstrumentOld) GetFilename() string {
 	return util.GetString(i.Filename[:])
 }
+
+const (
+	// oldEnvelopeEnd is the tick value that marks the end of the node points of an old format envelope
+	oldEnvelopeEnd = 0xFF
+	// defaultEnvelopeLength is the tick of the last node of the default (flat) envelopes
+	defaultEnvelopeLength = 100
+)
+
+// ToIMPIInstrument converts the old format instrument into the modern IMPIInstrument shape
+// The volume envelope is built from the node points (the precomputed VolumeEnvelope table is not needed), the
+// fadeout is scaled to the modern range and the panning and pitch envelopes, which the old format lacks,
+// are set up as disabled flat envelopes.
+func (i *IMPIInstrumentOld) ToIMPIInstrument() *IMPIInstrument {
+	inst := IMPIInstrument{
+		IMPI:                 i.IMPI,
+		Filename:             i.Filename,
+		Nul10:                i.Nul10,
+		NewNoteAction:        i.NewNoteAction,
+		DuplicateCheckType:   DuplicateCheckTypeOff,
+		DuplicateCheckAction: DuplicateCheckActionCut,
+		// the old fadeout ranges from 0 to 64 and the new one from 0 to 128
+		Fadeout:            i.Fadeout * 2,
+		PitchPanCenter:     60, // C-5
+		GlobalVolume:       FineVolume(DefaultFineVolume),
+		DefaultPan:         PanValue(32 | 128), // centered, but not used
+		TrackerVersion:     i.TrackerVersion,
+		SampleCount:        i.SampleCount,
+		Name:               i.Name,
+		MidiProgram:        0xFF,
+		MidiBank:           0xFFFF,
+		NoteSampleKeyboard: i.NoteSampleKeyboard,
+		PanningEnvelope:    defaultEnvelope(),
+		PitchEnvelope:      defaultEnvelope(),
+	}
+	if i.DuplicateNoteCheck == DuplicateNoteCheckOn {
+		inst.DuplicateCheckType = DuplicateCheckTypeNote
+	}
+
+	env := &inst.VolumeEnvelope
+	if i.Flags&IMPIOldFlagUseVolumeEnvelope != 0 {
+		env.Flags |= EnvelopeFlagEnvelopeOn
+	}
+	if i.Flags&IMPIOldFlagUseVolumeLoop != 0 {
+		env.Flags |= EnvelopeFlagLoopOn
+	}
+	if i.Flags&IMPIOldFlagUseSustainVolumeLoop != 0 {
+		env.Flags |= EnvelopeFlagSustainLoopOn
+	}
+	env.LoopBegin = i.VolumeLoopStart
+	env.LoopEnd = i.VolumeLoopEnd
+	env.SustainLoopBegin = i.SustainLoopStart
+	env.SustainLoopEnd = i.SustainLoopEnd
+	for _, np := range i.NodePoints {
+		if np.Tick == oldEnvelopeEnd {
+			break
+		}
+		env.NodePoints[env.Count] = NodePoint24{
+			Y:    int8(np.Magnitude),
+			Tick: uint16(np.Tick),
+		}
+		env.Count++
+	}
+
+	return &inst
+}
+
+// defaultEnvelope returns a disabled envelope that stays at the center value
+func defaultEnvelope() Envelope {
+	env := Envelope{
+		Count: 2,
+	}
+	env.NodePoints[1].Tick = defaultEnvelopeLength
+	return env
+}
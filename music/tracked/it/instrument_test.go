@@ -0,0 +1,71 @@
+package it
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestIMPIInstrumentOldSize(t *testing.T) {
+	// old format instruments take up 554 bytes on disk
+	const impiOldSize = 554
+
+	if size := binary.Size(IMPIInstrumentOld{}); size != impiOldSize {
+		t.Errorf("unexpected size %d", size)
+	}
+}
+
+func TestToIMPIInstrument(t *testing.T) {
+	old := &IMPIInstrumentOld{
+		Flags:              IMPIOldFlagUseVolumeEnvelope | IMPIOldFlagUseSustainVolumeLoop,
+		SustainLoopStart:   1,
+		SustainLoopEnd:     1,
+		Fadeout:            50,
+		DuplicateNoteCheck: DuplicateNoteCheckOn,
+		SampleCount:        1,
+	}
+	copy(old.IMPI[:], "IMPI")
+	copy(old.Name[:], "old instrument")
+	old.NoteSampleKeyboard[60] = NoteSample{Note: 60, Sample: 1}
+	// three nodes, followed by the end marker and a node that must be ignored
+	old.NodePoints[0] = NodePoint16{Tick: 0, Magnitude: 64}
+	old.NodePoints[1] = NodePoint16{Tick: 10, Magnitude: 32}
+	old.NodePoints[2] = NodePoint16{Tick: 20, Magnitude: 0}
+	old.NodePoints[3] = NodePoint16{Tick: 0xFF}
+	old.NodePoints[4] = NodePoint16{Tick: 30, Magnitude: 16}
+
+	inst := old.ToIMPIInstrument()
+
+	if inst.Fadeout != 100 {
+		t.Errorf("unexpected fadeout %d", inst.Fadeout)
+	}
+	if inst.DuplicateCheckType != DuplicateCheckTypeNote {
+		t.Errorf("unexpected duplicate check type %d", inst.DuplicateCheckType)
+	}
+	if inst.GetName() != "old instrument" || inst.SampleCount != 1 || inst.NoteSampleKeyboard[60] != old.NoteSampleKeyboard[60] {
+		t.Error("the instrument details were not copied")
+	}
+
+	env := &inst.VolumeEnvelope
+	if env.Flags != EnvelopeFlagEnvelopeOn|EnvelopeFlagSustainLoopOn {
+		t.Errorf("unexpected volume envelope flags %#02x", env.Flags)
+	}
+	if env.SustainLoopBegin != 1 || env.SustainLoopEnd != 1 {
+		t.Errorf("unexpected sustain loop %d-%d", env.SustainLoopBegin, env.SustainLoopEnd)
+	}
+	if env.Count != 3 {
+		t.Fatalf("unexpected number of volume envelope nodes %d", env.Count)
+	}
+	if np := env.NodePoints[1]; np.Y != 32 || np.Tick != 10 {
+		t.Errorf("unexpected volume envelope node %+v", np)
+	}
+
+	// the panning and pitch envelopes are disabled and flat
+	for _, env := range []*Envelope{&inst.PanningEnvelope, &inst.PitchEnvelope} {
+		if env.Flags != 0 || env.Count != 2 {
+			t.Errorf("unexpected envelope flags %#02x and number of nodes %d", env.Flags, env.Count)
+		}
+		if env.NodePoints[0] != (NodePoint24{}) || env.NodePoints[1] != (NodePoint24{Tick: 100}) {
+			t.Errorf("unexpected envelope nodes %+v", env.NodePoints[:2])
+		}
+	}
+}
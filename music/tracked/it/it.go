@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/gotracker/goaudiofile/internal/util"
@@ -26,16 +27,37 @@ type File struct {
 	Samples            []FullSample
 	Patterns           []PackedPattern
 	Blocks             []block.Block
+	Extensions         []block.Block // the XTPM and STPM blocks that OpenMPT writes after the sample data
+	History            []HistoryEntry
+	MIDIConfig         *block.MIDIConfig // only set when the file embeds a MIDI configuration
+	Message            []byte            // the song message, exactly as stored in the file (see MessageBytes and MessageString)
+	Unparsed           *Unparsed
+}
+
+// Unparsed holds the parts of the file that the reader does not interpret
+// It is only filled in when reading with the PreserveUnparsed option
+type Unparsed struct {
+	BlocksOffset     ParaPointer32 // where the extension blocks start
+	ExtensionsOffset ParaPointer32 // where the XTPM and STPM blocks start (0 if the file has none)
+	Gaps             []Gap
+}
+
+// Gap is a range of bytes not consumed by the reader, kept verbatim
+type Gap struct {
+	Offset int
+	Data   []byte
 }
 
 // FullSample is a full sample, header + data
 type FullSample struct {
 	Header Sample
-	Data   []byte
+	Data   []byte // signed little-endian PCM, with the channels of stereo samples interleaved
 }
 
 // Read reads an IT file from the reader `r` and creates an internal File representation
-func Read(r io.Reader) (*File, error) {
+func Read(r io.Reader, opts ...ReadOption) (*File, error) {
+	o := util.GetReadOptions(opts)
+
 	buffer := &bytes.Buffer{}
 	if _, err := buffer.ReadFrom(r); err != nil {
 		return nil, err
@@ -77,37 +99,60 @@ func Read(r io.Reader) (*File, error) {
 	// the earliest valid position to read from
 	valPos := ParaPointer32(0x00C0 + len(f.OrderList) + len(f.InstrumentPointers)*4 + len(f.SamplePointers)*4 + len(f.PatternPointers)*4)
 
+	cov := util.NewCoverage(len(data))
+	cov.Mark(0, valPos.Offset())
+
 	if f.Head.SpecialFlags.IsHistoryIncluded() {
-		var historyParaLen uint16
-		if err := binary.Read(buffer, binary.LittleEndian, &historyParaLen); err != nil {
+		var historyCount uint16
+		if err := binary.Read(buffer, binary.LittleEndian, &historyCount); err != nil {
 			return nil, err
 		}
 
-		hist := int(historyParaLen)*8 + valPos.Offset() + 2
-		if hist >= valPos.Offset() && hist < len(data) {
-			// TODO: read history values
-			valPos += ParaPointer32(historyParaLen)*8 + 2
+		hist := int(historyCount)*historyEntrySize + valPos.Offset() + 2
+		if hist >= valPos.Offset() && hist <= len(data) {
+			f.History = make([]HistoryEntry, int(historyCount))
+			if err := binary.Read(buffer, binary.LittleEndian, &f.History); err != nil {
+				return nil, err
+			}
+			cov.Mark(valPos.Offset(), hist-valPos.Offset())
+			valPos = ParaPointer32(hist)
 		}
 	}
 
+	if f.Head.SpecialFlags.IsEmbedMidi() {
+		if valPos.Offset()+block.MIDIConfigSize <= len(data) {
+			f.MIDIConfig = &block.MIDIConfig{}
+			if err := binary.Read(bytes.NewReader(data[valPos.Offset():]), binary.LittleEndian, f.MIDIConfig); err != nil {
+				return nil, err
+			}
+			cov.Mark(valPos.Offset(), block.MIDIConfigSize)
+			valPos += block.MIDIConfigSize
+		}
+	}
+
+	// blocks can only exist up until the first parapointed structure
+	firstPtr := f.firstParaPointer(len(data))
+
+	blocksOffset := valPos
 	nextValPos := valPos
 blockReadLoop:
-	for {
-		block, err := readBlock(data, nextValPos, f.Head.TrackerCompatVersion)
-		if err != nil || block == nil {
+	for nextValPos < firstPtr {
+		b, err := block.Read(data[nextValPos.Offset():])
+		if err != nil || b == nil {
 			break blockReadLoop
 		}
 
-		blen := block.Length()
+		blen := b.Length()
 		if blen < 8 {
 			break blockReadLoop
 		}
 
-		if block.FourCC() == 0x494d5049 { // IMPI
+		if b.FourCC() == 0x494d5049 { // IMPI
 			break blockReadLoop
 		}
 
-		f.Blocks = append(f.Blocks, block)
+		f.Blocks = append(f.Blocks, b)
+		cov.Mark(nextValPos.Offset(), block.ParsedLength(b))
 		nextValPos += ParaPointer32(blen)
 
 		if nextValPos.Offset() < len(data) {
@@ -115,6 +160,14 @@ blockReadLoop:
 		}
 	}
 
+	// OpenMPT writes its extensions right after the last structure (usually the last sample's data)
+	structuresEnd := nextValPos.Offset()
+	noteEnd := func(ofs int, n int) {
+		if ofs+n > structuresEnd {
+			structuresEnd = ofs + n
+		}
+	}
+
 	for _, ptr := range f.InstrumentPointers {
 		if ptr < valPos {
 			return nil, ErrInvalidFileFormat
@@ -125,6 +178,8 @@ blockReadLoop:
 			return nil, ErrInvalidFileFormat
 		}
 		f.Instruments = append(f.Instruments, impi)
+		cov.Mark(ptr.Offset(), binary.Size(impi))
+		noteEnd(ptr.Offset(), binary.Size(impi))
 	}
 
 	for _, ptr := range f.SamplePointers {
@@ -136,6 +191,8 @@ blockReadLoop:
 		if err != nil {
 			return nil, ErrInvalidFileFormat
 		}
+		cov.Mark(ptr.Offset(), sampleHeaderSize)
+		noteEnd(ptr.Offset(), sampleHeaderSize)
 
 		fs := FullSample{
 			Header: *imps,
@@ -143,25 +200,24 @@ blockReadLoop:
 		}
 
 		if fs.Header.Flags.DoesSampleExist() {
-			slen := fs.Header.Length
-			if fs.Header.Flags.Is16Bit() {
-				slen *= 2
-			}
-			if fs.Header.Flags.IsStereo() {
-				slen *= 2
-			}
-
-			fs.Data = make([]byte, slen)
-			if err := readSampleData(data, fs.Header.SamplePointer, f.Head.TrackerCompatVersion, fs.Data); err != nil {
+			sd, n, err := readSampleData(data, &fs.Header, f.Head.TrackerCompatVersion)
+			if err != nil {
 				return nil, err
 			}
+			fs.Data = sd
+			noteEnd(fs.Header.SamplePointer.Offset(), n)
+			if isNativeSampleFormat(&fs.Header) {
+				// anything else is kept as a gap, as the writer can't reproduce the original encoding
+				cov.Mark(fs.Header.SamplePointer.Offset(), n)
+			}
 		}
 
 		f.Samples = append(f.Samples, fs)
 	}
 
 	for _, ptr := range f.PatternPointers {
-		if ptr < valPos {
+		// a nil pointer is a valid (empty) pattern
+		if ptr != 0 && ptr < valPos {
 			return nil, ErrInvalidFileFormat
 		}
 
@@ -170,7 +226,484 @@ blockReadLoop:
 			return nil, ErrInvalidFileFormat
 		}
 		f.Patterns = append(f.Patterns, *pat)
+		if ptr != 0 {
+			cov.Mark(ptr.Offset(), 8+len(pat.Data))
+			noteEnd(ptr.Offset(), 8+len(pat.Data))
+		}
+	}
+
+	if f.Head.SpecialFlags.IsMessageAttached() && f.Head.MessageLength > 0 {
+		ofs := f.Head.MessageOffset.Offset()
+		end := ofs + int(f.Head.MessageLength)
+		if end > len(data) {
+			end = len(data)
+		}
+		if ofs < end {
+			f.Message = append([]byte{}, data[ofs:end]...)
+			cov.Mark(ofs, end-ofs)
+			noteEnd(ofs, end-ofs)
+		}
+	}
+
+	var extensionsOffset ParaPointer32
+	if structuresEnd < len(data) {
+		exts, n := block.ReadExtensions(data[structuresEnd:], len(f.Instruments))
+		if len(exts) > 0 {
+			f.Extensions = exts
+			extensionsOffset = ParaPointer32(structuresEnd)
+			cov.Mark(structuresEnd, n)
+		}
+	}
+
+	if o.PreserveUnparsed {
+		f.Unparsed = &Unparsed{
+			BlocksOffset:     blocksOffset,
+			ExtensionsOffset: extensionsOffset,
+		}
+		for _, g := range cov.Gaps() {
+			f.Unparsed.Gaps = append(f.Unparsed.Gaps, Gap{
+				Offset: g.Offset,
+				Data:   append([]byte{}, data[g.Offset:g.Offset+g.Length]...),
+			})
+		}
 	}
 
 	return &f, nil
 }
+
+// NormalizedInstruments returns all of the instruments in the modern IMPIInstrument shape (see NormalizeInstrument)
+func (f *File) NormalizedInstruments() ([]*IMPIInstrument, error) {
+	insts := make([]*IMPIInstrument, 0, len(f.Instruments))
+	for _, inst := range f.Instruments {
+		ii, err := NormalizeInstrument(inst)
+		if err != nil {
+			return nil, err
+		}
+		insts = append(insts, ii)
+	}
+	return insts, nil
+}
+
+func (f *File) firstParaPointer(dataLen int) ParaPointer32 {
+	first := ParaPointer32(dataLen)
+	check := func(ptrs []ParaPointer32) {
+		for _, ptr := range ptrs {
+			if ptr != 0 && ptr < first {
+				first = ptr
+			}
+		}
+	}
+	check(f.InstrumentPointers)
+	check(f.SamplePointers)
+	check(f.PatternPointers)
+	if f.Head.SpecialFlags.IsMessageAttached() && f.Head.MessageLength > 0 {
+		check([]ParaPointer32{f.Head.MessageOffset})
+	}
+	return first
+}
+
+const (
+	// sampleHeaderSize is the size of an IMPS sample header
+	sampleHeaderSize = 0x50
+)
+
+// fileLayout describes where each structure of an IT file is placed
+type fileLayout struct {
+	head               ModuleHeader
+	instrumentPointers []ParaPointer32
+	samplePointers     []ParaPointer32
+	patternPointers    []ParaPointer32
+	samples            []Sample
+	blocksOffset       int
+	extensionsOffset   int
+	// preserved is set when the structures are written back exactly as they were read,
+	// without any of the padding or placeholder values used for a fresh layout
+	preserved bool
+	gaps      []Gap
+}
+
+// Write writes the internal IT File representation `f` to the writer `w`
+// All parapointers (and the counts in the module header) are recalculated from the contents of `f`,
+// unless `f` was read with the PreserveUnparsed option, in which case the original layout is kept
+// for as long as the (possibly modified) contents still fit into it
+func Write(w io.Writer, f *File) error {
+	if f == nil {
+		return errors.New("f is nil")
+	}
+
+	if l, err := f.preservedLayout(); err != nil {
+		return err
+	} else if l != nil {
+		data, err := f.encode(l)
+		if err == nil {
+			_, err = w.Write(data)
+			return err
+		}
+		if !errors.Is(err, util.ErrImageConflict) {
+			return err
+		}
+	}
+
+	l, err := f.freshLayout()
+	if err != nil {
+		return err
+	}
+
+	data, err := f.encode(l)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// preservedLayout returns the layout of the file as it was read, or nil if it can no longer be used
+func (f *File) preservedLayout() (*fileLayout, error) {
+	if f.Unparsed == nil {
+		return nil, nil
+	}
+
+	if len(f.InstrumentPointers) != len(f.Instruments) ||
+		len(f.SamplePointers) != len(f.Samples) ||
+		len(f.PatternPointers) != len(f.Patterns) {
+		return nil, nil
+	}
+
+	for i, ptr := range f.PatternPointers {
+		if ptr == 0 && !f.Patterns[i].isEmpty() {
+			return nil, nil
+		}
+	}
+
+	fh := f.Head
+	fh.OrderCount = uint16(len(f.OrderList))
+	if len(f.Message) > 0 {
+		if len(f.Message) > 0xFFFF || fh.MessageOffset == 0 {
+			return nil, nil
+		}
+		fh.SpecialFlags |= IMPMSpecialFlagMessageAttached
+		fh.MessageLength = uint16(len(f.Message))
+	} else if fh.SpecialFlags.IsMessageAttached() && fh.MessageLength > 0 {
+		return nil, nil
+	}
+	if len(f.History) > 0 && !fh.SpecialFlags.IsHistoryIncluded() {
+		return nil, nil
+	}
+	if (f.MIDIConfig != nil) != fh.SpecialFlags.IsEmbedMidi() {
+		return nil, nil
+	}
+	if len(f.Extensions) > 0 && f.Unparsed.ExtensionsOffset == 0 {
+		return nil, nil
+	}
+
+	l := fileLayout{
+		head:               fh,
+		instrumentPointers: f.InstrumentPointers,
+		samplePointers:     f.SamplePointers,
+		patternPointers:    f.PatternPointers,
+		samples:            make([]Sample, len(f.Samples)),
+		blocksOffset:       f.Unparsed.BlocksOffset.Offset(),
+		extensionsOffset:   f.Unparsed.ExtensionsOffset.Offset(),
+		preserved:          true,
+		gaps:               f.Unparsed.Gaps,
+	}
+
+	for i, fs := range f.Samples {
+		l.samples[i] = fs.Header
+		hdr := &l.samples[i]
+		if !hdr.Flags.DoesSampleExist() {
+			continue
+		}
+
+		if !isNativeSampleFormat(hdr) {
+			// the original encoding is kept in the gaps, but only while it still decodes to the sample data
+			if !f.Unparsed.isSampleDataCurrent(hdr, fs.Data) {
+				return nil, nil
+			}
+			continue
+		}
+
+		length, err := sampleLength(i, hdr, fs.Data)
+		if err != nil {
+			return nil, err
+		}
+		hdr.Length = length
+	}
+
+	return &l, nil
+}
+
+// freshLayout places every structure of the file one after another
+func (f *File) freshLayout() (*fileLayout, error) {
+	fh := f.Head
+	fh.OrderCount = uint16(len(f.OrderList))
+	fh.InstrumentCount = uint16(len(f.Instruments))
+	fh.SampleCount = uint16(len(f.Samples))
+	fh.PatternCount = uint16(len(f.Patterns))
+	fh.SpecialFlags &^= IMPMSpecialFlagEmbedMidi
+	if f.MIDIConfig != nil {
+		fh.SpecialFlags |= IMPMSpecialFlagEmbedMidi
+	}
+
+	l := fileLayout{
+		instrumentPointers: make([]ParaPointer32, len(f.Instruments)),
+		samplePointers:     make([]ParaPointer32, len(f.Samples)),
+		patternPointers:    make([]ParaPointer32, len(f.Patterns)),
+		samples:            make([]Sample, len(f.Samples)),
+	}
+
+	pos := 0x00C0 + len(f.OrderList) + len(f.Instruments)*4 + len(f.Samples)*4 + len(f.Patterns)*4
+	if len(f.History) > 0xFFFF {
+		return nil, errors.New("too many history entries")
+	} else if len(f.History) > 0 {
+		fh.SpecialFlags |= IMPMSpecialFlagHistoryIncluded
+	}
+	if fh.SpecialFlags.IsHistoryIncluded() {
+		pos += 2 + len(f.History)*historyEntrySize
+	}
+	if fh.SpecialFlags.IsEmbedMidi() {
+		pos += block.MIDIConfigSize
+	}
+
+	l.blocksOffset = pos
+	for _, b := range f.Blocks {
+		buf := &bytes.Buffer{}
+		if err := block.Write(buf, b, false); err != nil {
+			return nil, err
+		}
+		pos += buf.Len()
+	}
+
+	fh.SpecialFlags &^= IMPMSpecialFlagMessageAttached
+	fh.MessageLength = 0
+	fh.MessageOffset = 0
+	if len(f.Message) > 0 {
+		if len(f.Message) > 0xFFFF {
+			return nil, errors.New("message is too long")
+		}
+		fh.SpecialFlags |= IMPMSpecialFlagMessageAttached
+		fh.MessageLength = uint16(len(f.Message))
+		fh.MessageOffset = ParaPointer32(pos)
+		pos += len(f.Message)
+	}
+
+	for i := range f.Instruments {
+		l.instrumentPointers[i] = ParaPointer32(pos)
+		pos += impiSize
+	}
+
+	for i := range f.Samples {
+		l.samplePointers[i] = ParaPointer32(pos)
+		pos += sampleHeaderSize
+	}
+
+	for i := range f.Patterns {
+		p := &f.Patterns[i]
+		if p.isEmpty() {
+			continue
+		}
+		l.patternPointers[i] = ParaPointer32(pos)
+		pos += 8 + len(p.Data)
+	}
+
+	for i, fs := range f.Samples {
+		l.samples[i] = fs.Header
+		hdr := &l.samples[i]
+		hdr.SamplePointer = 0
+		if !hdr.Flags.DoesSampleExist() {
+			continue
+		}
+
+		// the sample data was decoded by the reader, so it's written back as plain signed PCM
+		hdr.Flags &^= SampleFlagCompressed
+		hdr.ConvertFlags &^= ConvertFlagBigEndian | ConvertFlagSampleDelta | ConvertFlagByteDelta | ConvertFlagTXWave12Bit
+		hdr.ConvertFlags |= ConvertFlagSignedSamples
+
+		length, err := sampleLength(i, hdr, fs.Data)
+		if err != nil {
+			return nil, err
+		}
+		hdr.Length = length
+
+		if len(fs.Data) > 0 {
+			hdr.SamplePointer = ParaPointer32(pos)
+			pos += len(fs.Data)
+		}
+	}
+
+	l.extensionsOffset = pos
+	l.head = fh
+	return &l, nil
+}
+
+// isSampleDataCurrent returns true when the sample data kept in the gaps still decodes to `data`
+func (u *Unparsed) isSampleDataCurrent(hdr *Sample, data []byte) bool {
+	if length, err := sampleLength(0, hdr, data); err != nil || length != hdr.Length {
+		return false
+	}
+
+	ofs := hdr.SamplePointer.Offset()
+	for _, g := range u.Gaps {
+		if ofs < g.Offset || ofs >= g.Offset+len(g.Data) {
+			continue
+		}
+
+		orig := Sample{
+			Flags:         hdr.Flags,
+			ConvertFlags:  hdr.ConvertFlags,
+			Length:        hdr.Length,
+			SamplePointer: ParaPointer32(ofs - g.Offset),
+		}
+		decoded, _, err := readSampleData(g.Data, &orig, 0)
+		if err != nil {
+			return false
+		}
+		return bytes.Equal(decoded, data)
+	}
+	return false
+}
+
+// sampleLength returns the length (in sample frames) of the uncompressed sample data `data`
+func sampleLength(i int, hdr *Sample, data []byte) (uint32, error) {
+	frameSize := 1
+	if hdr.Flags.Is16Bit() {
+		frameSize *= 2
+	}
+	if hdr.Flags.IsStereo() {
+		frameSize *= 2
+	}
+	if len(data)%frameSize != 0 {
+		return 0, fmt.Errorf("sample %d has a partial sample frame", i+1)
+	}
+	return uint32(len(data) / frameSize), nil
+}
+
+// encode builds the binary image of the file using the layout `l`
+func (f *File) encode(l *fileLayout) ([]byte, error) {
+	var im util.Image
+	for _, g := range l.gaps {
+		if err := im.Place(g.Offset, g.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	tables := &bytes.Buffer{}
+	if err := WriteModuleHeader(tables, &l.head); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, f.OrderList); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, l.instrumentPointers); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, l.samplePointers); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, l.patternPointers); err != nil {
+		return nil, err
+	}
+	if l.head.SpecialFlags.IsHistoryIncluded() {
+		if err := binary.Write(tables, binary.LittleEndian, uint16(len(f.History))); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(tables, binary.LittleEndian, f.History); err != nil {
+			return nil, err
+		}
+	}
+	if l.head.SpecialFlags.IsEmbedMidi() {
+		if err := binary.Write(tables, binary.LittleEndian, f.MIDIConfig); err != nil {
+			return nil, err
+		}
+	}
+	if err := im.Place(0, tables.Bytes()); err != nil {
+		return nil, err
+	}
+
+	pos := l.blocksOffset
+	for _, b := range f.Blocks {
+		buf := &bytes.Buffer{}
+		if err := block.Write(buf, b, l.preserved); err != nil {
+			return nil, err
+		}
+		if err := im.Place(pos, buf.Bytes()); err != nil {
+			return nil, err
+		}
+		// when preserving, the unparsed remainder of a block is filled in from the gaps
+		pos += 8 + int(binary.LittleEndian.Uint32(buf.Bytes()[4:8]))
+	}
+
+	if len(f.Message) > 0 {
+		if err := im.Place(l.head.MessageOffset.Offset(), f.Message); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, inst := range f.Instruments {
+		buf := &bytes.Buffer{}
+		if err := writeIMPI(buf, inst, l.head.TrackerCompatVersion); err != nil {
+			return nil, err
+		}
+		if !l.preserved {
+			// both instrument layouts are padded to the same size
+			buf.Write(make([]byte, impiSize-buf.Len()))
+		}
+		if err := im.Place(l.instrumentPointers[i].Offset(), buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range l.samples {
+		buf := &bytes.Buffer{}
+		if err := writeIMPS(buf, &l.samples[i]); err != nil {
+			return nil, err
+		}
+		if err := im.Place(l.samplePointers[i].Offset(), buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range f.Patterns {
+		ptr := l.patternPointers[i]
+		if ptr == 0 {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		if err := writePackedPattern(buf, &f.Patterns[i]); err != nil {
+			return nil, err
+		}
+		if err := im.Place(ptr.Offset(), buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, fs := range f.Samples {
+		hdr := &l.samples[i]
+		ptr := hdr.SamplePointer
+		if ptr == 0 || !hdr.Flags.DoesSampleExist() {
+			continue
+		}
+		if l.preserved && !isNativeSampleFormat(hdr) {
+			// kept in the gaps
+			continue
+		}
+		if err := im.Place(ptr.Offset(), encodeSampleData(hdr, fs.Data)); err != nil {
+			return nil, err
+		}
+	}
+
+	pos = l.extensionsOffset
+	for _, b := range f.Extensions {
+		buf := &bytes.Buffer{}
+		if err := block.Write(buf, b, l.preserved); err != nil {
+			return nil, err
+		}
+		if err := im.Place(pos, buf.Bytes()); err != nil {
+			return nil, err
+		}
+		pos += buf.Len()
+	}
+
+	return im.Bytes(), nil
+}
@@ -0,0 +1,140 @@
+package it
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/gotracker/goaudiofile/internal/testutil"
+
+	"github.com/gotracker/goaudiofile/music/tracked/it/block"
+)
+
+// newTestFile creates a file with an instrument, two samples, two patterns, a song message and pattern names
+func newTestFile() *File {
+	f := &File{}
+	copy(f.Head.IMPM[:], "IMPM")
+	copy(f.Head.Name[:], "test song")
+	f.Head.TrackerVersion = 0x0214
+	f.Head.TrackerCompatVersion = 0x0214
+	f.Head.Flags = IMPMFlagUseInstruments
+	f.Head.SpecialFlags = IMPMSpecialFlagHistoryIncluded
+	f.Head.GlobalVolume = 128
+	f.Head.MixingVolume = 48
+	f.OrderList = []uint8{0, 1, 255}
+
+	inst := &IMPIInstrument{Fadeout: 256, SampleCount: 1}
+	copy(inst.IMPI[:], "IMPI")
+	copy(inst.Name[:], "test instrument")
+	inst.VolumeEnvelope.Count = 2
+	inst.VolumeEnvelope.NodePoints[1] = NodePoint24{Y: 64, Tick: 10}
+	f.Instruments = []IMPIIntf{inst}
+
+	s := Sample{GlobalVolume: 64, Flags: SampleFlagSampleExists | SampleFlag16Bit, Volume: 64, ConvertFlags: 1, C5Speed: 8363}
+	copy(s.IMPS[:], "IMPS")
+	copy(s.Name[:], "test sample")
+	empty := Sample{}
+	copy(empty.IMPS[:], "IMPS")
+	f.Samples = []FullSample{
+		{Header: s, Data: []byte{1, 0, 2, 0, 3, 0, 4, 0}},
+		{Header: empty, Data: []byte{}},
+	}
+
+	f.Patterns = []PackedPattern{
+		// C-5 of instrument 1, with a volume of 32 and a speed command, on the first channel of the first row
+		{Rows: 32, Data: append([]byte{0x81, 0x0F, 60, 1, 32, 1, 0x10}, make([]byte, 32)...)},
+		{Rows: 64, Data: make([]byte, 64)},
+	}
+	for i := range f.Patterns {
+		f.Patterns[i].Length = uint16(len(f.Patterns[i].Data))
+	}
+
+	pn := &block.PatternNames{Name: make([]block.PatternName, 2)}
+	pn.Identifier = block.BlockIdent{'P', 'N', 'A', 'M'}
+	copy(pn.Name[0][:], "intro")
+	f.Blocks = []block.Block{pn}
+	f.Message = []byte("hello\rworld\x00")
+	return f
+}
+
+// buildTestFile writes the file created by newTestFile
+func buildTestFile(t *testing.T) []byte {
+	return writeTestFile(t, newTestFile())
+}
+
+func writeTestFile(t *testing.T, f *File) []byte {
+	out := &bytes.Buffer{}
+	if err := Write(out, f); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func readPreserved(r io.Reader) (*File, error) {
+	return Read(r, PreserveUnparsed())
+}
+
+func TestPreserveUnparsedRoundTrip(t *testing.T) {
+	data := buildTestFile(t)
+
+	// data after the last structure isn't covered by File
+	data = append(data, "trailing data"...)
+
+	f := testutil.RoundTrip(t, data, readPreserved, Write)
+
+	if len(f.Instruments) != 1 || len(f.Samples) != 2 || len(f.Patterns) != 2 || len(f.Blocks) != 1 {
+		t.Fatalf("unexpected file contents")
+	}
+	if string(f.Message) != "hello\rworld\x00" {
+		t.Errorf("unexpected message %q", f.Message)
+	}
+}
+
+func TestPreserveCompressedSample(t *testing.T) {
+	// write the compressed data as if it were an uncompressed 8-bit sample,
+	// then turn the sample header into the one of a compressed sample
+	f := newTestFile()
+	compressed := testCompressed8Bit()
+	f.Samples[0].Header.Flags = SampleFlagSampleExists
+	f.Samples[0].Data = compressed
+	data := writeTestFile(t, f)
+
+	hdr := bytes.Index(data, []byte("IMPS"))
+	data[hdr+0x12] |= uint8(SampleFlagCompressed)
+	binary.LittleEndian.PutUint32(data[hdr+0x30:], 5)
+
+	f = testutil.RoundTrip(t, data, readPreserved, Write)
+
+	if s := f.Samples[0].Data; !bytes.Equal(s, []byte{5, 2, 1, 4, 0xF4}) {
+		t.Errorf("unexpected sample data % x", s)
+	}
+}
+
+func TestPreserveMessageAndMIDIConfig(t *testing.T) {
+	f := newTestFile()
+	f.MIDIConfig = &block.MIDIConfig{}
+	copy(f.MIDIConfig.Global[block.MIDIGlobalStart][:], "FF")
+	copy(f.MIDIConfig.SFx[0][:], "F0F000z")
+	for i := range f.MIDIConfig.Zxx {
+		copy(f.MIDIConfig.Zxx[i][:], fmt.Sprintf("F0F001%02X", i))
+	}
+	data := writeTestFile(t, f)
+
+	// leave the end of the message area to the gaps, by making the message shorter
+	const messageLengthOffset = 0x36
+	binary.LittleEndian.PutUint16(data[messageLengthOffset:], uint16(len(f.Message)-3))
+
+	g := testutil.RoundTrip(t, data, readPreserved, Write)
+
+	if g.MIDIConfig == nil || *g.MIDIConfig != *f.MIDIConfig {
+		t.Fatal("unexpected MIDI configuration")
+	}
+	if out := g.MIDIConfig.SFx[0].Evaluate(block.MIDIMacroParams{Z: 0x12}); !bytes.Equal(out, []byte{0xF0, 0xF0, 0x00, 0x12}) {
+		t.Errorf("unexpected MIDI data % x", out)
+	}
+	if string(g.Message) != "hello\rwor" {
+		t.Errorf("unexpected message %q", g.Message)
+	}
+}
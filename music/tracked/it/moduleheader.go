@@ -47,3 +47,8 @@ func ReadModuleHeader(r io.Reader) (*ModuleHeader, error) {
 
 	return &mh, nil
 }
+
+// WriteModuleHeader writes a ModuleHeader to the output stream
+func WriteModuleHeader(w io.Writer, mh *ModuleHeader) error {
+	return binary.Write(w, binary.LittleEndian, mh)
+}
@@ -0,0 +1,12 @@
+package it
+
+import "github.com/gotracker/goaudiofile/internal/util"
+
+// ReadOption is an optional setting for Read
+type ReadOption = util.ReadOption
+
+// PreserveUnparsed makes Read keep every range of the file that no other structure of File covers in File.Unparsed,
+// along with the offset of the extension blocks, so that Write reproduces the original layout
+func PreserveUnparsed() ReadOption {
+	return util.PreserveUnparsed()
+}
@@ -4,6 +4,20 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// maxPatternChannels is the number of channels addressable by a packed pattern
+	maxPatternChannels = 64
+	// maxPatternRows is the largest number of rows in a pattern
+	maxPatternRows = 200
+)
+
+var (
+	// ErrPatternRowCount is for when the packed pattern data does not hold the number of rows in the pattern header
+	ErrPatternRowCount = errors.New("pattern row count mismatch")
 )
 
 // PackedPattern is a packed pattern from the IT format
@@ -25,6 +39,9 @@ type ChannelData struct {
 	CommandData   uint8
 }
 
+// PatternRow is a single row of an unpacked pattern, indexed by channel
+type PatternRow []ChannelData
+
 func readPackedPattern(data []byte, ptr ParaPointer, cmwt uint16) (*PackedPattern, error) {
 	ofs := ptr.Offset()
 	if ofs == 0 {
@@ -58,6 +75,43 @@ func readPackedPattern(data []byte, ptr ParaPointer, cmwt uint16) (*PackedPatter
 	return &p, nil
 }
 
+func writePackedPattern(w io.Writer, p *PackedPattern) error {
+	if len(p.Data) > 0xFFFF {
+		return errors.New("packed pattern data is too large")
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(p.Data))); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Rows); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, p.Reserved04); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(p.Data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// isEmpty returns true if the pattern is the empty pattern that IT denotes with a nil pointer
+func (p *PackedPattern) isEmpty() bool {
+	if p.Rows != 64 || len(p.Data) != 64 {
+		return false
+	}
+	for _, d := range p.Data {
+		if d != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // ReadChannelData decodes a packed pattern from the position indicated (`pos`) and returns an
 // integer equal to the number of bytes used to decode the channel data, a ChannelData structure,
 // and a possible error value.
@@ -151,3 +205,162 @@ func (p *PackedPattern) ReadChannelData(pos int, rowMem []ChannelData) (int, *Ch
 
 	return s, &cd, nil
 }
+
+// Unpack decodes the whole packed pattern into a grid of Rows rows by 64 channels
+// Values recalled from the previous-value memory are filled in, as ReadChannelData does,
+// and channels without any data are left with no flags set
+func (p *PackedPattern) Unpack() ([]PatternRow, error) {
+	rowMem := make([]ChannelData, maxPatternChannels)
+	rows := make([]PatternRow, 0, int(p.Rows))
+	row := newPatternRow()
+	rowOpen := false
+	for pos := 0; pos < len(p.Data); {
+		n, cd, err := p.ReadChannelData(pos, rowMem)
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+
+		if cd == nil {
+			rows = append(rows, row)
+			row = newPatternRow()
+			rowOpen = false
+			continue
+		}
+
+		row[int(cd.ChannelNumber)] = *cd
+		rowOpen = true
+	}
+
+	if rowOpen {
+		return nil, errors.New("packed pattern data ends in the middle of a row")
+	}
+
+	if len(rows) != int(p.Rows) {
+		return nil, fmt.Errorf("%w: expected %d rows, found %d", ErrPatternRowCount, p.Rows, len(rows))
+	}
+
+	return rows, nil
+}
+
+func newPatternRow() PatternRow {
+	row := make(PatternRow, maxPatternChannels)
+	for c := range row {
+		row[c].ChannelNumber = int8(c)
+	}
+	return row
+}
+
+// Pack compresses the grid of channel data `rows` into the packed pattern, updating Rows, Length and Data
+// A channel is written when any of its Has or UseLast flags are set, and a value that matches the
+// previous value written for the channel is replaced by the matching UseLast flag
+func (p *PackedPattern) Pack(rows []PatternRow) error {
+	if len(rows) < 1 || len(rows) > maxPatternRows {
+		return fmt.Errorf("pattern row count %d out of range", len(rows))
+	}
+
+	type channelMem struct {
+		mask uint8
+		ChannelData
+		// players start without any previous values, so a value has to be written once before it can be reused
+		hasNote       bool
+		hasInstrument bool
+		hasVolPan     bool
+		hasCommand    bool
+	}
+	mem := make([]channelMem, maxPatternChannels)
+
+	packed := &bytes.Buffer{}
+	for r, row := range rows {
+		if len(row) > maxPatternChannels {
+			return fmt.Errorf("row %d has too many channels", r)
+		}
+
+		for c, cd := range row {
+			m := &mem[c]
+			var mask uint8
+			var values []uint8
+
+			if cd.Flags.HasNote() || cd.Flags.IsUseLastNote() {
+				if m.hasNote && cd.Note == m.Note {
+					mask |= uint8(ChannelDataFlagUseLastNote)
+				} else {
+					mask |= uint8(ChannelDataFlagNote)
+					values = append(values, uint8(cd.Note))
+				}
+			}
+
+			if cd.Flags.HasInstrument() || cd.Flags.IsUseLastInstrument() {
+				if m.hasInstrument && cd.Instrument == m.Instrument {
+					mask |= uint8(ChannelDataFlagUseLastInstrument)
+				} else {
+					mask |= uint8(ChannelDataFlagInstrument)
+					values = append(values, cd.Instrument)
+				}
+			}
+
+			if cd.Flags.HasVolPan() || cd.Flags.IsUseLastVolPan() {
+				if m.hasVolPan && cd.VolPan == m.VolPan {
+					mask |= uint8(ChannelDataFlagUseLastVolPan)
+				} else {
+					mask |= uint8(ChannelDataFlagVolPan)
+					values = append(values, cd.VolPan)
+				}
+			}
+
+			if cd.Flags.HasCommand() || cd.Flags.IsUseLastCommand() {
+				if m.hasCommand && cd.Command == m.Command && cd.CommandData == m.CommandData {
+					mask |= uint8(ChannelDataFlagUseLastCommand)
+				} else {
+					mask |= uint8(ChannelDataFlagCommand)
+					values = append(values, cd.Command, cd.CommandData)
+				}
+			}
+
+			if mask == 0 {
+				continue
+			}
+
+			// the channel memory is only updated with values that are actually stored
+			if mask&uint8(ChannelDataFlagNote) != 0 {
+				m.Note = cd.Note
+				m.hasNote = true
+			}
+			if mask&uint8(ChannelDataFlagInstrument) != 0 {
+				m.Instrument = cd.Instrument
+				m.hasInstrument = true
+			}
+			if mask&uint8(ChannelDataFlagVolPan) != 0 {
+				m.VolPan = cd.VolPan
+				m.hasVolPan = true
+			}
+			if mask&uint8(ChannelDataFlagCommand) != 0 {
+				m.Command = cd.Command
+				m.CommandData = cd.CommandData
+				m.hasCommand = true
+			}
+
+			channelVar := uint8(c + 1)
+			if mask == m.mask {
+				packed.WriteByte(channelVar)
+			} else {
+				packed.WriteByte(channelVar | 0x80)
+				packed.WriteByte(mask)
+				m.mask = mask
+			}
+			packed.Write(values)
+		}
+
+		// end of row
+		packed.WriteByte(0)
+	}
+
+	if packed.Len() > 0xFFFF {
+		return errors.New("packed pattern data is too large")
+	}
+
+	p.Rows = uint16(len(rows))
+	p.Data = packed.Bytes()
+	p.Length = uint16(len(p.Data))
+	return nil
+}
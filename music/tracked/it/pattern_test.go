@@ -0,0 +1,54 @@
+package it
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPackFirstValuesAreExplicit(t *testing.T) {
+	rows := []PatternRow{newPatternRow(), newPatternRow()}
+	// C-0 and v00 match the zero values, but nothing has been written yet
+	rows[0][0].Flags = ChannelDataFlagNote | ChannelDataFlagVolPan
+	rows[1][0].Flags = ChannelDataFlagNote | ChannelDataFlagVolPan
+
+	var p PackedPattern
+	if err := p.Pack(rows); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		0x81, uint8(ChannelDataFlagNote | ChannelDataFlagVolPan), 0x00, 0x00, 0x00,
+		0x81, uint8(ChannelDataFlagUseLastNote | ChannelDataFlagUseLastVolPan), 0x00,
+	}
+	if !bytes.Equal(p.Data, expected) {
+		t.Errorf("unexpected packed data % x", p.Data)
+	}
+
+	unpacked, err := p.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r, row := range unpacked {
+		if !row[0].Flags.HasNote() || !row[0].Flags.HasVolPan() || row[0].Note != 0 || row[0].VolPan != 0 {
+			t.Errorf("row %d: unexpected channel data %+v", r, row[0])
+		}
+	}
+}
+
+func TestPackRowCount(t *testing.T) {
+	var p PackedPattern
+	if err := p.Pack(nil); err == nil {
+		t.Error("expected an error for a pattern without rows")
+	}
+
+	rows := make([]PatternRow, maxPatternRows+1)
+	for i := range rows {
+		rows[i] = newPatternRow()
+	}
+	if err := p.Pack(rows); err == nil {
+		t.Error("expected an error for a pattern with too many rows")
+	}
+	if err := p.Pack(rows[:maxPatternRows]); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,37 @@
+package it
+
+import "github.com/gotracker/goaudiofile/music/pcm"
+
+// PCM converts the sample data into a normalized sample
+func (fs *FullSample) PCM() *pcm.Sample {
+	channels := 1
+	if fs.Header.Flags.IsStereo() {
+		channels = 2
+	}
+
+	var p *pcm.Sample
+	if fs.Header.Flags.Is16Bit() {
+		p = pcm.FromSigned16LE(fs.Data, channels)
+	} else {
+		p = pcm.FromSigned8(fs.Data, channels)
+	}
+
+	p.BaseFrequency = float64(fs.Header.C5Speed)
+
+	frames := p.Frames()
+	if fs.Header.Flags.IsLoopEnabled() {
+		mode := pcm.LoopModeForward
+		if fs.Header.Flags.IsLoopPingPong() {
+			mode = pcm.LoopModePingPong
+		}
+		p.Loop = pcm.NewLoop(mode, int(fs.Header.LoopBegin), int(fs.Header.LoopEnd), frames)
+	}
+	if fs.Header.Flags.IsSustainLoopEnabled() {
+		mode := pcm.LoopModeForward
+		if fs.Header.Flags.IsSustainLoopPingPong() {
+			mode = pcm.LoopModePingPong
+		}
+		p.SustainLoop = pcm.NewLoop(mode, int(fs.Header.SustainLoopBegin), int(fs.Header.SustainLoopEnd), frames)
+	}
+	return p
+}
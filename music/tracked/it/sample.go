@@ -3,6 +3,8 @@ package it
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
 
 	"github.com/gotracker/goaudiofile/internal/util"
 )
@@ -53,13 +55,18 @@ func readIMPS(data []byte, ptr ParaPointer, cmwt uint16) (*Sample, error) {
 	return &sample, nil
 }
 
-func readSampleData(data []byte, ptr ParaPointer, cmwt uint16, out []byte) error {
-	ofs := ptr.Offset()
-	r := bytes.NewBuffer(data[ofs:])
-
-	if _, err := r.Read(out); err != nil {
-		return err
+// readSampleData reads and decodes the sample data described by `hdr` (see DecodeSampleData),
+// and returns it along with the number of bytes of `data` that were used
+func readSampleData(data []byte, hdr *Sample, cmwt uint16) ([]byte, int, error) {
+	ofs := hdr.SamplePointer.Offset()
+	if ofs > len(data) {
+		return nil, 0, errors.New("sample data out of range")
 	}
 
-	return nil
+	out, n := DecodeSampleData(hdr, data[ofs:])
+	return out, n, nil
+}
+
+func writeIMPS(w io.Writer, sample *Sample) error {
+	return binary.Write(w, binary.LittleEndian, sample)
 }
@@ -0,0 +1,197 @@
+package it
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/gotracker/goaudiofile/music/pcm"
+)
+
+// DecodeSampleData converts the sample data `data`, stored as described by the sample header `hdr`, into
+// signed little-endian PCM, with the channels of stereo samples interleaved
+// All combinations of the ConvertFlags are honored, as is IT214/IT215 compression.
+// It returns the decoded data and the number of bytes of `data` that were used.
+// Data that ends early leaves the rest of the sample silent.
+func DecodeSampleData(hdr *Sample, data []byte) ([]byte, int) {
+	frames := int(hdr.Length)
+	channels := 1
+	if hdr.Flags.IsStereo() {
+		channels = 2
+	}
+	bytesPerSample := 1
+	if hdr.Flags.Is16Bit() {
+		bytesPerSample = 2
+	}
+
+	// stereo samples are stored one channel after the other
+	channelLen := frames * bytesPerSample
+	planar := make([]byte, channelLen*channels)
+	pos := 0
+	for c := 0; c < channels; c++ {
+		out := planar[c*channelLen : (c+1)*channelLen]
+		in := data[pos:]
+
+		switch {
+		case hdr.Flags.IsCompressed():
+			// compressed samples are always signed and the delta flag selects IT215 compression
+			pos += decompressSample(in, frames, hdr.Flags.Is16Bit(), hdr.ConvertFlags.IsSampleDelta(), out)
+			continue
+
+		case hdr.Flags.Is16Bit() && hdr.ConvertFlags.IsTXWave12Bit():
+			pos += decodeTXWave12Bit(in, frames, out)
+
+		default:
+			pos += copy(out, in)
+			if hdr.Flags.Is16Bit() && hdr.ConvertFlags.IsBigEndian() {
+				for i := 0; i+1 < len(out); i += 2 {
+					out[i], out[i+1] = out[i+1], out[i]
+				}
+			}
+			if hdr.ConvertFlags.IsByteDelta() {
+				// every byte is a delta from the previous byte, regardless of the sample size
+				var old uint8
+				for i := range out {
+					old += out[i]
+					out[i] = old
+				}
+			}
+		}
+
+		if hdr.ConvertFlags.IsSampleDelta() {
+			undeltaSampleData(out, hdr.Flags.Is16Bit())
+		}
+		if !hdr.ConvertFlags.IsSignedSamples() {
+			flipSampleSign(out, hdr.Flags.Is16Bit())
+		}
+	}
+
+	if pos > len(data) {
+		pos = len(data)
+	}
+
+	return pcm.Interleave(planar, channels, bytesPerSample), pos
+}
+
+// encodeSampleData converts signed little-endian interleaved PCM into the layout written by Write:
+// signed little-endian PCM, with the channels of stereo samples stored one after the other
+func encodeSampleData(hdr *Sample, pcm []byte) []byte {
+	if !hdr.Flags.IsStereo() {
+		return pcm
+	}
+
+	bytesPerSample := 1
+	if hdr.Flags.Is16Bit() {
+		bytesPerSample = 2
+	}
+	frameSize := bytesPerSample * 2
+	channelLen := len(pcm) / 2
+
+	planar := make([]byte, len(pcm))
+	for i := 0; i < len(pcm)/frameSize; i++ {
+		for c := 0; c < 2; c++ {
+			src := pcm[i*frameSize+c*bytesPerSample:]
+			copy(planar[c*channelLen+i*bytesPerSample:], src[:bytesPerSample])
+		}
+	}
+	return planar
+}
+
+// isNativeSampleFormat returns true when the sample data is stored exactly as DecodeSampleData returns it
+func isNativeSampleFormat(hdr *Sample) bool {
+	if hdr.Flags.IsCompressed() || hdr.Flags.IsStereo() {
+		return false
+	}
+	const nonNative = ConvertFlagBigEndian | ConvertFlagSampleDelta | ConvertFlagByteDelta | ConvertFlagTXWave12Bit
+	return hdr.ConvertFlags.IsSignedSamples() && hdr.ConvertFlags&nonNative == 0
+}
+
+// decodeTXWave12Bit unpacks TX-Wave (Yamaha TX16W) 12-bit samples, stored as 3 bytes for every 2 samples,
+// into 16-bit values and returns the number of bytes of `data` that were used
+func decodeTXWave12Bit(data []byte, frames int, out []byte) int {
+	get := func(i int) uint16 {
+		if i < len(data) {
+			return uint16(data[i])
+		}
+		return 0
+	}
+
+	for i := 0; i < frames; i++ {
+		ofs := (i / 2) * 3
+		var s uint16
+		if i&1 == 0 {
+			s = get(ofs)<<8 | get(ofs+1)&0xF0
+		} else {
+			s = get(ofs+2)<<8 | (get(ofs+1)&0x0F)<<4
+		}
+		binary.LittleEndian.PutUint16(out[i*2:], s)
+	}
+
+	n := (frames*3 + 1) / 2
+	if n > len(data) {
+		n = len(data)
+	}
+	return n
+}
+
+func undeltaSampleData(data []byte, is16Bit bool) {
+	if is16Bit {
+		var old uint16
+		for i := 0; i+1 < len(data); i += 2 {
+			old += binary.LittleEndian.Uint16(data[i:])
+			binary.LittleEndian.PutUint16(data[i:], old)
+		}
+		return
+	}
+
+	var old uint8
+	for i := range data {
+		old += data[i]
+		data[i] = old
+	}
+}
+
+func flipSampleSign(data []byte, is16Bit bool) {
+	if is16Bit {
+		for i := 1; i < len(data); i += 2 {
+			data[i] ^= 0x80
+		}
+		return
+	}
+
+	for i := range data {
+		data[i] ^= 0x80
+	}
+}
+
+// ReadSampleFile reads a standalone IT sample (.its) file from the reader `r`
+// The sample data is decoded with DecodeSampleData.
+func ReadSampleFile(r io.Reader) (*FullSample, error) {
+	buffer := &bytes.Buffer{}
+	if _, err := buffer.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	data := buffer.Bytes()
+
+	imps, err := readIMPS(data, ParaPointer32(0), 0)
+	if err != nil {
+		return nil, err
+	}
+	if string(imps.IMPS[:]) != "IMPS" {
+		return nil, errors.New("invalid sample file format")
+	}
+
+	fs := FullSample{
+		Header: *imps,
+		Data:   make([]byte, 0),
+	}
+
+	if fs.Header.Flags.DoesSampleExist() {
+		if fs.Data, _, err = readSampleData(data, &fs.Header, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return &fs, nil
+}
@@ -0,0 +1,84 @@
+package it
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDecodeSampleData(t *testing.T) {
+	const (
+		signed = ConvertFlagSignedSamples
+		s16    = SampleFlagSampleExists | SampleFlag16Bit
+		s8     = SampleFlagSampleExists
+	)
+
+	for _, tc := range []struct {
+		name     string
+		flags    SampleFlags
+		convert  ConvertFlags
+		frames   uint32
+		data     []byte
+		expected []byte
+		used     int
+	}{
+		{"signed 8-bit", s8, signed, 2, []byte{0x01, 0xFF}, []byte{0x01, 0xFF}, 2},
+		{"unsigned 8-bit", s8, 0, 3, []byte{0x80, 0x81, 0x7F}, []byte{0x00, 0x01, 0xFF}, 3},
+		{"unsigned 16-bit", s16, 0, 2, []byte{0x00, 0x80, 0xFF, 0x7F}, []byte{0x00, 0x00, 0xFF, 0xFF}, 4},
+		{"big-endian 16-bit", s16, signed | ConvertFlagBigEndian, 1, []byte{0x12, 0x34}, []byte{0x34, 0x12}, 2},
+		{"delta 8-bit", s8, signed | ConvertFlagSampleDelta, 3, []byte{0x01, 0x01, 0xFE}, []byte{0x01, 0x02, 0x00}, 3},
+		{"delta 16-bit", s16, signed | ConvertFlagSampleDelta, 2, []byte{0x00, 0x01, 0x00, 0x01}, []byte{0x00, 0x01, 0x00, 0x02}, 4},
+		{"unsigned delta 8-bit", s8, ConvertFlagSampleDelta, 2, []byte{0x80, 0x01}, []byte{0x00, 0x01}, 2},
+		{"byte delta 16-bit", s16, signed | ConvertFlagByteDelta, 2, []byte{0x01, 0x01, 0x01, 0x01}, []byte{0x01, 0x02, 0x03, 0x04}, 4},
+		{"TX-Wave 12-bit", s16, signed | ConvertFlagTXWave12Bit, 2, []byte{0x12, 0x34, 0x56}, []byte{0x30, 0x12, 0x40, 0x56}, 3},
+		{"stereo 8-bit", s8 | SampleFlagStereo, signed, 2, []byte{0x01, 0x02, 0x03, 0x04}, []byte{0x01, 0x03, 0x02, 0x04}, 4},
+		{"stereo 16-bit", s16 | SampleFlagStereo, signed, 1, []byte{0x01, 0x02, 0x03, 0x04}, []byte{0x01, 0x02, 0x03, 0x04}, 4},
+		{"truncated", s8, signed, 4, []byte{0x01, 0x02}, []byte{0x01, 0x02, 0x00, 0x00}, 2},
+	} {
+		hdr := &Sample{Flags: tc.flags, ConvertFlags: tc.convert, Length: tc.frames}
+		out, n := DecodeSampleData(hdr, tc.data)
+		if !bytes.Equal(out, tc.expected) {
+			t.Errorf("%s: unexpected sample data % x", tc.name, out)
+		}
+		if n != tc.used {
+			t.Errorf("%s: %d bytes used instead of %d", tc.name, n, tc.used)
+		}
+	}
+}
+
+func TestReadSampleFile(t *testing.T) {
+	hdr := Sample{
+		Flags:        SampleFlagSampleExists,
+		GlobalVolume: 64,
+		Volume:       64,
+		Length:       4,
+		C5Speed:      8363,
+	}
+	copy(hdr.IMPS[:], "IMPS")
+	copy(hdr.Name[:], "test sample")
+	hdr.SamplePointer = ParaPointer32(binary.Size(hdr))
+
+	b := &bytes.Buffer{}
+	if err := binary.Write(b, binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	// unsigned 8-bit sample data
+	b.Write([]byte{0x80, 0xC0, 0x80, 0x40})
+
+	fs, err := ReadSampleFile(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := fs.Header.GetName(); name != "test sample" {
+		t.Errorf("unexpected name %q", name)
+	}
+	if !bytes.Equal(fs.Data, []byte{0x00, 0x40, 0x00, 0xC0}) {
+		t.Errorf("unexpected sample data % x", fs.Data)
+	}
+
+	data := b.Bytes()
+	copy(data, "IMPI")
+	if _, err := ReadSampleFile(bytes.NewReader(data)); err == nil {
+		t.Error("expected an error for a file without the IMPS identifier")
+	}
+}
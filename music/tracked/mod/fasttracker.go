@@ -33,10 +33,33 @@ func (f *fmtFT) readPattern(ffmt *modFormatDetails, r io.Reader) (*Pattern, erro
 	return &p, nil
 }
 
+func (f *fmtFT) writePattern(ffmt *modFormatDetails, w io.Writer, p *Pattern) error {
+	if w == nil {
+		return errors.New("w is nil")
+	}
+
+	for _, row := range p {
+		if len(row) != ffmt.channels {
+			return errors.New("unexpected number of channels in pattern row")
+		}
+		for c := 0; c < ffmt.channels; c++ {
+			if err := binary.Write(w, binary.LittleEndian, &row[c]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func (f *fmtFT) rectifyOrderList(ffmt *modFormatDetails, in [128]uint8) ([128]uint8, error) {
 	return in, nil
 }
 
+func (f *fmtFT) restoreOrderList(ffmt *modFormatDetails, in [128]uint8) ([128]uint8, error) {
+	return in, nil
+}
+
 func init() {
 	// fasttracker
 	signatureLookup["2CHN"] = modFormatDetails{2, fasttracker}
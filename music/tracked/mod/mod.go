@@ -3,6 +3,7 @@ package mod
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/gotracker/goaudiofile/internal/util"
@@ -13,11 +14,20 @@ type File struct {
 	Head     ModuleHeader
 	Patterns []Pattern
 	Samples  []SampleData
+	Unparsed *Unparsed // only kept when reading with PreserveUnparsed
+}
+
+// Unparsed is the data of a MOD file that the other structures of File do not represent
+type Unparsed struct {
+	Order    [128]uint8 // the order list exactly as it is stored in the file
+	Trailing []byte     // any data following the last sample
 }
 
 type formatIntf interface {
 	readPattern(*modFormatDetails, io.Reader) (*Pattern, error)
+	writePattern(*modFormatDetails, io.Writer, *Pattern) error
 	rectifyOrderList(*modFormatDetails, [128]uint8) ([128]uint8, error)
+	restoreOrderList(*modFormatDetails, [128]uint8) ([128]uint8, error)
 }
 
 type modFormatDetails struct {
@@ -30,22 +40,23 @@ var (
 )
 
 // Read reads a MOD file from the reader `r` and creates an internal MOD File representation
-func Read(r io.Reader) (*File, error) {
+func Read(r io.Reader, opts ...ReadOption) (*File, error) {
+	o := util.GetReadOptions(opts)
 	f := File{}
 
 	if err := binary.Read(r, binary.LittleEndian, &f.Head); err != nil {
 		return nil, err
 	}
 
-	sig := util.GetString(f.Head.Sig[:])
-	var ffmt *modFormatDetails
-	s, ok := signatureLookup[sig]
-	if ok {
-		ffmt = &s
+	if o.PreserveUnparsed {
+		f.Unparsed = &Unparsed{
+			Order: f.Head.Order,
+		}
 	}
 
-	if ffmt == nil || ffmt.channels == 0 {
-		return nil, errors.New("invalid file format")
+	ffmt, err := lookupFormat(&f.Head)
+	if err != nil {
+		return nil, err
 	}
 
 	processor := ffmt.format
@@ -53,7 +64,6 @@ func Read(r io.Reader) (*File, error) {
 		return nil, errors.New("could not identify format reader")
 	}
 
-	numPatterns := 0
 	orderList, err := processor.rectifyOrderList(ffmt, f.Head.Order)
 	if err != nil {
 		return nil, err
@@ -62,12 +72,8 @@ func Read(r io.Reader) (*File, error) {
 		if i < int(f.Head.SongLen) {
 			f.Head.Order[i] = o
 		}
-		// we count all patterns, even if we're not in the 'song' range
-		// hidden/'deleted' patterns can exist...
-		if numPatterns <= int(o) {
-			numPatterns = int(o) + 1
-		}
 	}
+	numPatterns := countPatterns(orderList)
 
 	f.Patterns = make([]Pattern, numPatterns)
 	for i := 0; i < numPatterns; i++ {
@@ -90,5 +96,142 @@ func Read(r io.Reader) (*File, error) {
 		f.Samples[instNum] = samp
 	}
 
+	if f.Unparsed != nil {
+		trailing, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		f.Unparsed.Trailing = trailing
+	}
+
 	return &f, nil
 }
+
+// Write writes the internal MOD File representation `f` to the writer `w`
+// The sample lengths in the written header are taken from the sample data, not from `f.Head`
+// If `f` was read with PreserveUnparsed, the unparsed data is written back out as well
+func Write(w io.Writer, f *File) error {
+	if f == nil {
+		return errors.New("f is nil")
+	}
+
+	head := f.Head
+
+	ffmt, err := lookupFormat(&head)
+	if err != nil {
+		return err
+	}
+
+	processor := ffmt.format
+	if processor == nil {
+		return errors.New("could not identify format writer")
+	}
+
+	orderList, err := processor.restoreOrderList(ffmt, head.Order)
+	if err != nil {
+		return err
+	}
+	for i, o := range orderList {
+		if i < int(head.SongLen) {
+			head.Order[i] = o
+		}
+	}
+	if f.Unparsed != nil {
+		// keep the stored order values as long as they still mean the same thing
+		stored, err := processor.rectifyOrderList(ffmt, f.Unparsed.Order)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(head.SongLen) && i < len(stored); i++ {
+			if stored[i] == f.Head.Order[i] {
+				head.Order[i] = f.Unparsed.Order[i]
+			}
+		}
+	}
+
+	// the reader determines the number of patterns from the order list,
+	// so we have to make sure that both agree with each other
+	rectified, err := processor.rectifyOrderList(ffmt, head.Order)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < int(head.SongLen) && i < len(rectified); i++ {
+		if rectified[i] != f.Head.Order[i] {
+			return errors.New("order list entry out of range")
+		}
+	}
+	if countPatterns(rectified) != len(f.Patterns) {
+		return errors.New("number of patterns does not match the order list")
+	}
+
+	if len(f.Samples) > len(head.Instrument) {
+		return errors.New("too many samples")
+	}
+
+	samples := make([]SampleData, len(head.Instrument))
+	copy(samples, f.Samples)
+	for instNum := range head.Instrument {
+		samp := samples[instNum]
+		if len(samp)&1 != 0 {
+			// lengths are stored in words, so pad out to the next one
+			samp = append(append(SampleData{}, samp...), 0)
+			samples[instNum] = samp
+		}
+		words := len(samp) >> 1
+		if words > 0xFFFF {
+			return fmt.Errorf("sample %d is too long", instNum+1)
+		}
+		head.Instrument[instNum].Len = WordLength(BE16ToLE16(uint16(words)))
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, &head); err != nil {
+		return err
+	}
+
+	for i := range f.Patterns {
+		if err := processor.writePattern(ffmt, w, &f.Patterns[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, samp := range samples {
+		if err := binary.Write(w, binary.LittleEndian, []uint8(samp)); err != nil {
+			return err
+		}
+	}
+
+	if f.Unparsed != nil {
+		if _, err := w.Write(f.Unparsed.Trailing); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lookupFormat(head *ModuleHeader) (*modFormatDetails, error) {
+	sig := util.GetString(head.Sig[:])
+	var ffmt *modFormatDetails
+	s, ok := signatureLookup[sig]
+	if ok {
+		ffmt = &s
+	}
+
+	if ffmt == nil || ffmt.channels == 0 {
+		return nil, errors.New("invalid file format")
+	}
+
+	return ffmt, nil
+}
+
+func countPatterns(orderList [128]uint8) int {
+	numPatterns := 0
+	for _, o := range orderList {
+		// we count all patterns, even if we're not in the 'song' range
+		// hidden/'deleted' patterns can exist...
+		if numPatterns <= int(o) {
+			numPatterns = int(o) + 1
+		}
+	}
+	return numPatterns
+}
@@ -0,0 +1,166 @@
+package mod
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/gotracker/goaudiofile/internal/testutil"
+)
+
+// newTestFile creates an empty file with the signature `sig`, playing each of `numPatterns` patterns once
+func newTestFile(sig string, numPatterns int) *File {
+	f := &File{}
+	copy(f.Head.Name[:], "test song")
+	copy(f.Head.Sig[:], sig)
+	f.Head.SongLen = uint8(numPatterns)
+	f.Head.RestartPos = 0x7F
+	for i := 0; i < numPatterns; i++ {
+		f.Head.Order[i] = uint8(i)
+	}
+	return f
+}
+
+func TestWriteFLT8(t *testing.T) {
+	f := newTestFile("FLT8", 2)
+	for p := 0; p < 2; p++ {
+		pattern := NewPattern(8)
+		for r, row := range pattern {
+			for c := range row {
+				row[c] = Channel{uint8(p), uint8(r), uint8(c), 0}
+			}
+		}
+		f.Patterns = append(f.Patterns, pattern)
+	}
+
+	out := &bytes.Buffer{}
+	if err := Write(out, f); err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+
+	// each 8 channel pattern is stored as two 4 channel patterns, which the order list counts separately
+	const orderOffset = 20 + 31*30 + 2
+	if data[orderOffset] != 0 || data[orderOffset+1] != 2 {
+		t.Errorf("unexpected order list % x", data[orderOffset:orderOffset+2])
+	}
+
+	const patternOffset = orderOffset + 128 + 4
+	const halfLen = 64 * 4 * 4
+	if len(data) != patternOffset+2*2*halfLen {
+		t.Fatalf("unexpected file length %d", len(data))
+	}
+	for p := 0; p < 2; p++ {
+		for half := 0; half < 2; half++ {
+			start := patternOffset + (p*2+half)*halfLen
+			// the last channel of the last row of this half
+			last := Channel(data[start+halfLen-4 : start+halfLen])
+			if expected := (Channel{uint8(p), 63, uint8(half*4 + 3), 0}); last != expected {
+				t.Errorf("pattern %d, half %d: unexpected channel data % x", p, half, last)
+			}
+		}
+	}
+
+	g, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Head.Order[0] != 0 || g.Head.Order[1] != 1 {
+		t.Errorf("unexpected order list after reading % x", g.Head.Order[:2])
+	}
+	if len(g.Patterns) != 2 {
+		t.Fatalf("unexpected number of patterns %d", len(g.Patterns))
+	}
+	for p := range f.Patterns {
+		for r := range f.Patterns[p] {
+			for c := range f.Patterns[p][r] {
+				if g.Patterns[p][r][c] != f.Patterns[p][r][c] {
+					t.Fatalf("pattern %d, row %d, channel %d: unexpected channel data % x", p, r, c, g.Patterns[p][r][c])
+				}
+			}
+		}
+	}
+}
+
+func TestWriteOddSampleLength(t *testing.T) {
+	f := newTestFile("M.K.", 1)
+	f.Patterns = []Pattern{NewPattern(4)}
+	f.Samples = []SampleData{{1, 2, 3}, {4, 5}}
+
+	out := &bytes.Buffer{}
+	if err := Write(out, f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Samples[0]) != 3 {
+		t.Error("the sample data of the file was modified")
+	}
+
+	g, err := Read(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := g.Head.Instrument[0].Len.Value(); l != 4 {
+		t.Errorf("unexpected length %d of the first sample", l)
+	}
+	if !bytes.Equal(g.Samples[0], []byte{1, 2, 3, 0}) {
+		t.Errorf("unexpected data % x of the first sample", g.Samples[0])
+	}
+	if !bytes.Equal(g.Samples[1], []byte{4, 5}) {
+		t.Errorf("unexpected data % x of the second sample", g.Samples[1])
+	}
+}
+
+// buildTestFile builds a 4 channel ProTracker file with two patterns, a single sample and some trailing data
+func buildTestFile() []byte {
+	b := &bytes.Buffer{}
+
+	name := make([]byte, 20)
+	copy(name, "test song")
+	b.Write(name)
+
+	for i := 0; i < 31; i++ {
+		inst := make([]byte, 30)
+		if i == 0 {
+			copy(inst, "test sample")
+			inst[22], inst[23] = 0x00, 0x04 // length: 4 words
+			inst[25] = 64                   // volume
+			inst[29] = 0x01                 // loop length: 1 word
+		}
+		b.Write(inst)
+	}
+
+	b.WriteByte(2)    // song length
+	b.WriteByte(0x7F) // restart position
+	order := make([]byte, 128)
+	order[1] = 1
+	b.Write(order)
+	b.WriteString("M.K.")
+
+	for p := 0; p < 2; p++ {
+		pattern := make([]byte, 64*4*4)
+		// sample 1, period 428 (C-2) and a volume of 32 on the first channel of the first row
+		copy(pattern, []byte{0x01, 0xAC, 0x1C, 0x20})
+		// a pattern break on the last channel of the second row
+		copy(pattern[(1*4+3)*4:], []byte{0x00, 0x00, 0x0D, 0x00})
+		b.Write(pattern)
+	}
+
+	b.Write([]byte{0x00, 0x10, 0x20, 0x30, 0x40, 0x30, 0x20, 0x10})
+	b.WriteString("trailing data")
+	return b.Bytes()
+}
+
+func readPreserved(r io.Reader) (*File, error) {
+	return Read(r, PreserveUnparsed())
+}
+
+func TestPreserveUnparsedRoundTrip(t *testing.T) {
+	f := testutil.RoundTrip(t, buildTestFile(), readPreserved, Write)
+
+	if len(f.Patterns) != 2 || len(f.Samples) != 31 || len(f.Samples[0]) != 8 {
+		t.Fatalf("unexpected file contents")
+	}
+	if string(f.Unparsed.Trailing) != "trailing data" {
+		t.Errorf("unexpected trailing data %q", f.Unparsed.Trailing)
+	}
+}
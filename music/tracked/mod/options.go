@@ -0,0 +1,12 @@
+package mod
+
+import "github.com/gotracker/goaudiofile/internal/util"
+
+// ReadOption is an optional setting for Read
+type ReadOption = util.ReadOption
+
+// PreserveUnparsed makes Read keep the order list as it is stored and any data following the last sample
+// in File.Unparsed, so that Write reproduces the original file
+func PreserveUnparsed() ReadOption {
+	return util.PreserveUnparsed()
+}
@@ -0,0 +1,26 @@
+package mod
+
+import (
+	"math"
+
+	"github.com/gotracker/goaudiofile/music/pcm"
+)
+
+// modBaseFrequency is the playback rate of a sample with no finetune at middle C
+const modBaseFrequency = 8363
+
+// PCM converts the sample data `data` of the instrument into a normalized sample
+func (i *InstrumentHeader) PCM(data SampleData) *pcm.Sample {
+	s := pcm.FromSigned8(data, 1)
+
+	// the finetune is a signed nibble, in 1/8ths of a semitone
+	finetune := int8(i.FineTune<<4) >> 4
+	s.BaseFrequency = modBaseFrequency * math.Pow(2, float64(finetune)/(12*8))
+
+	// the loop is stored as a start and a length, and a length of a single word means no loop
+	begin, length := i.LoopStart.Value(), i.LoopEnd.Value()
+	if length > 2 {
+		s.Loop = pcm.NewLoop(pcm.LoopModeForward, begin, begin+length, s.Frames())
+	}
+	return s
+}
@@ -33,10 +33,33 @@ func (f *fmtPT) readPattern(ffmt *modFormatDetails, r io.Reader) (*Pattern, erro
 	return &p, nil
 }
 
+func (f *fmtPT) writePattern(ffmt *modFormatDetails, w io.Writer, p *Pattern) error {
+	if w == nil {
+		return errors.New("w is nil")
+	}
+
+	for _, row := range p {
+		if len(row) != ffmt.channels {
+			return errors.New("unexpected number of channels in pattern row")
+		}
+		for c := 0; c < ffmt.channels; c++ {
+			if err := binary.Write(w, binary.LittleEndian, &row[c]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func (f *fmtPT) rectifyOrderList(ffmt *modFormatDetails, in [128]uint8) ([128]uint8, error) {
 	return in, nil
 }
 
+func (f *fmtPT) restoreOrderList(ffmt *modFormatDetails, in [128]uint8) ([128]uint8, error) {
+	return in, nil
+}
+
 func init() {
 	signatureLookup["M.K."] = modFormatDetails{4, protracker}
 	signatureLookup["M!K!"] = modFormatDetails{4, protracker}
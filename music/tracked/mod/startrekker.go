@@ -43,6 +43,38 @@ func (f *fmtST) readPattern(ffmt *modFormatDetails, r io.Reader) (*Pattern, erro
 	return &p, nil
 }
 
+func (f *fmtST) writePattern(ffmt *modFormatDetails, w io.Writer, p *Pattern) error {
+	if w == nil {
+		return errors.New("w is nil")
+	}
+
+	for _, row := range p {
+		if len(row) != ffmt.channels {
+			return errors.New("unexpected number of channels in pattern row")
+		}
+	}
+
+	for _, row := range p {
+		for c := 0; c < 4; c++ {
+			if err := binary.Write(w, binary.LittleEndian, &row[c]); err != nil {
+				return err
+			}
+		}
+	}
+	// weird format... the second half of the channels is stored as its own 4-channel pattern
+	if ffmt.channels == 8 {
+		for _, row := range p {
+			for c := 4; c < 8; c++ {
+				if err := binary.Write(w, binary.LittleEndian, &row[c]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func (f *fmtST) rectifyOrderList(ffmt *modFormatDetails, in [128]uint8) ([128]uint8, error) {
 	// really weird format...
 	if ffmt.channels == 8 {
@@ -55,6 +87,18 @@ func (f *fmtST) rectifyOrderList(ffmt *modFormatDetails, in [128]uint8) ([128]ui
 	return in, nil
 }
 
+func (f *fmtST) restoreOrderList(ffmt *modFormatDetails, in [128]uint8) ([128]uint8, error) {
+	// the inverse of rectifyOrderList
+	if ffmt.channels == 8 {
+		out := [128]uint8{}
+		for i, o := range in {
+			out[i] = o * 2
+		}
+		return out, nil
+	}
+	return in, nil
+}
+
 func init() {
 	// fasttracker
 	signatureLookup["FLT4"] = modFormatDetails{4, startrekker}
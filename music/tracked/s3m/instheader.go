@@ -14,6 +14,19 @@ type HiLo32 struct {
 	Hi uint16
 }
 
+// NewHiLo32 splits the 32 bit value `v` into its low and high halves
+func NewHiLo32(v uint32) HiLo32 {
+	return HiLo32{
+		Lo: uint16(v),
+		Hi: uint16(v >> 16),
+	}
+}
+
+// Value returns the full 32 bit value
+func (h HiLo32) Value() uint32 {
+	return uint32(h.Hi)<<16 | uint32(h.Lo)
+}
+
 // SCRSType is the type of the SCRS instrument/sample
 type SCRSType uint8
 
@@ -52,7 +65,7 @@ type SCRSAncillaryHeader interface{}
 
 // SCRSNoneHeader is the remaining header for S3M none-type instrument
 type SCRSNoneHeader struct {
-	Reserved0D [19]byte
+	Reserved0D [15]byte
 	Volume     Volume
 	Reserved1D [3]byte
 	C2Spd      HiLo32
@@ -98,3 +111,18 @@ func ReadSCRS(r io.Reader) (*SCRS, error) {
 
 	return &sh, nil
 }
+
+// WriteSCRS writes an SCRS to the output stream
+func WriteSCRS(w io.Writer, sh *SCRS) error {
+	if err := binary.Write(w, binary.LittleEndian, &sh.Head); err != nil {
+		return err
+	}
+
+	if sh.Ancillary != nil {
+		if err := binary.Write(w, binary.LittleEndian, sh.Ancillary); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -35,10 +35,17 @@ type Packing uint8
 const (
 	// PackingUnpacked is an unpacked S3M PCM sample
 	PackingUnpacked = Packing(iota)
-	// PackingDP30ADPCM is Digiplayer/ST3 3.00 ADPCM packing
+	// PackingDP30ADPCM is Digiplayer/ST3 3.00 ADPCM packing, which the reader does not support
 	PackingDP30ADPCM
+	// PackingModPlugADPCM is the 4-bit ADPCM packing written by ModPlug Tracker
+	PackingModPlugADPCM = Packing(4)
 )
 
+// IsADPCM returns true if the sample data is packed with ModPlug 4-bit ADPCM
+func (p Packing) IsADPCM() bool {
+	return p == PackingModPlugADPCM
+}
+
 // SCRSDigiplayerHeader is the remaining header for S3M PCM samples
 type SCRSDigiplayerHeader struct {
 	MemSeg        ParaPointer24
@@ -62,3 +69,25 @@ type SCRSDigiplayerHeader struct {
 func (h *SCRSDigiplayerHeader) GetSampleName() string {
 	return util.GetString(h.SampleName[:])
 }
+
+// Loop returns the loop start and end (in sample frames) and whether the sample has a usable loop
+// A loop is only usable when the sample is flagged as looped and LoopBegin < LoopEnd <= Length
+func (h *SCRSDigiplayerHeader) Loop() (uint32, uint32, bool) {
+	begin, end := h.LoopBegin.Value(), h.LoopEnd.Value()
+	if !h.Flags.IsLooped() || begin >= end || end > h.Length.Value() {
+		return 0, 0, false
+	}
+	return begin, end, true
+}
+
+// frameSize returns the number of bytes used by each sample frame
+func (h *SCRSDigiplayerHeader) frameSize() int {
+	n := 1
+	if h.Flags.IsStereo() {
+		n *= 2
+	}
+	if h.Flags.Is16BitSample() {
+		n *= 2
+	}
+	return n
+}
@@ -0,0 +1,70 @@
+package s3m
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestSCRSSize(t *testing.T) {
+	// every SCRS block is 0x50 bytes long, no matter its type
+	const scrsSize = 0x50
+
+	headSize := binary.Size(SCRSHeader{})
+	for _, anc := range []SCRSAncillaryHeader{
+		SCRSNoneHeader{},
+		SCRSDigiplayerHeader{},
+		SCRSAdlibHeader{},
+	} {
+		if size := headSize + binary.Size(anc); size != scrsSize {
+			t.Errorf("%T: unexpected size %#x", anc, size)
+		}
+	}
+}
+
+func TestHiLo32(t *testing.T) {
+	h := NewHiLo32(0x12345678)
+	if h.Lo != 0x5678 || h.Hi != 0x1234 {
+		t.Errorf("unexpected halves %#04x and %#04x", h.Lo, h.Hi)
+	}
+	if v := h.Value(); v != 0x12345678 {
+		t.Errorf("unexpected value %#08x", v)
+	}
+
+	// the low half is stored first, so the value is stored as a little-endian 32 bit value
+	b := &bytes.Buffer{}
+	if err := binary.Write(b, binary.LittleEndian, h); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), []byte{0x78, 0x56, 0x34, 0x12}) {
+		t.Errorf("unexpected encoding % x", b.Bytes())
+	}
+}
+
+func TestLoop(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		flags           SCRSFlags
+		begin, end, len uint32
+		ok              bool
+	}{
+		{"beyond 64K", SCRSFlagsLooped, 0x10000, 0x18000, 0x20000, true},
+		{"whole sample", SCRSFlagsLooped, 0, 0x20000, 0x20000, true},
+		{"not looped", 0, 0x10000, 0x18000, 0x20000, false},
+		{"empty", SCRSFlagsLooped, 0x18000, 0x18000, 0x20000, false},
+		{"past the end", SCRSFlagsLooped, 0x10000, 0x20001, 0x20000, false},
+	} {
+		h := &SCRSDigiplayerHeader{
+			Flags:     tc.flags,
+			Length:    NewHiLo32(tc.len),
+			LoopBegin: NewHiLo32(tc.begin),
+			LoopEnd:   NewHiLo32(tc.end),
+		}
+		begin, end, ok := h.Loop()
+		if ok != tc.ok {
+			t.Errorf("%s: unexpected loop state %v", tc.name, ok)
+		} else if ok && (begin != tc.begin || end != tc.end) {
+			t.Errorf("%s: unexpected loop %#x-%#x", tc.name, begin, end)
+		}
+	}
+}
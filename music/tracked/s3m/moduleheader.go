@@ -35,6 +35,12 @@ func (mh *ModuleHeader) GetName() string {
 	return util.GetString(mh.Name[:])
 }
 
+// IsSignedSamples returns true if the sample data in the file is stored as signed values
+// (FileFormatInformation 1) instead of the usual unsigned values (FileFormatInformation 2)
+func (mh *ModuleHeader) IsSignedSamples() bool {
+	return mh.FileFormatInformation == 1
+}
+
 // ReadModuleHeader reads a ModuleHeader from the input stream
 func ReadModuleHeader(r io.Reader) (*ModuleHeader, error) {
 	var mh ModuleHeader
@@ -44,3 +50,8 @@ func ReadModuleHeader(r io.Reader) (*ModuleHeader, error) {
 
 	return &mh, nil
 }
+
+// WriteModuleHeader writes a ModuleHeader to the output stream
+func WriteModuleHeader(w io.Writer, mh *ModuleHeader) error {
+	return binary.Write(w, binary.LittleEndian, mh)
+}
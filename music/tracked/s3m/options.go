@@ -0,0 +1,12 @@
+package s3m
+
+import "github.com/gotracker/goaudiofile/internal/util"
+
+// ReadOption is an optional setting for Read
+type ReadOption = util.ReadOption
+
+// PreserveUnparsed makes Read keep every range of the file that no other structure of File covers, such as
+// padding and unreferenced data, in File.Unparsed, so that Write puts it back at its original offset
+func PreserveUnparsed() ReadOption {
+	return util.PreserveUnparsed()
+}
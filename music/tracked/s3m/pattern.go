@@ -1,11 +1,179 @@
 package s3m
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	// patternRows is the number of rows in every S3M pattern
+	patternRows = 64
+	// patternChannels is the number of channels addressable by a packed pattern
+	patternChannels = 32
+)
+
 // PackedPattern is the S3M packed pattern definition
 type PackedPattern struct {
 	Length uint16
 	Data   []byte
 }
 
+// isEmpty returns true if the pattern is the empty pattern that S3M denotes with a nil pointer
+func (p *PackedPattern) isEmpty() bool {
+	if len(p.Data) != 64 {
+		return false
+	}
+	for _, d := range p.Data {
+		if d != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ChannelData is the unpacked data of a single channel in a pattern row
+type ChannelData struct {
+	What       PatternFlags // the flags and channel id this entry was decoded from (zero if the channel was empty)
+	Note       Note
+	Instrument uint8
+	Volume     Volume
+	Command    uint8
+	Info       uint8
+}
+
+// EmptyChannelData returns the channel data of a channel with nothing in it
+func EmptyChannelData() ChannelData {
+	return ChannelData{
+		Note:   EmptyNote,
+		Volume: EmptyVolume,
+	}
+}
+
+// PatternRow is a single row of an unpacked pattern, indexed by channel
+type PatternRow []ChannelData
+
+// Unpack decodes the packed pattern into 64 rows of 32 channels
+// Rows missing from the end of the packed data are left empty, as players do
+func (p *PackedPattern) Unpack() ([]PatternRow, error) {
+	rows := make([]PatternRow, patternRows)
+	for r := range rows {
+		rows[r] = make(PatternRow, patternChannels)
+		for c := range rows[r] {
+			rows[r][c] = EmptyChannelData()
+		}
+	}
+
+	pos := 0
+	next := func() (uint8, error) {
+		if pos >= len(p.Data) {
+			return 0, errors.New("packed pattern data ends in the middle of a channel")
+		}
+		v := p.Data[pos]
+		pos++
+		return v, nil
+	}
+
+	for r := 0; r < patternRows && pos < len(p.Data); {
+		what := PatternFlags(p.Data[pos])
+		pos++
+		if what == 0 {
+			// end of row
+			r++
+			continue
+		}
+
+		cd := &rows[r][what.Channel()]
+		cd.What = what
+
+		if what.HasNote() {
+			n, err := next()
+			if err != nil {
+				return nil, err
+			}
+			i, err := next()
+			if err != nil {
+				return nil, err
+			}
+			cd.Note = Note(n)
+			cd.Instrument = i
+		}
+
+		if what.HasVolume() {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			cd.Volume = Volume(v)
+		}
+
+		if what.HasCommand() {
+			c, err := next()
+			if err != nil {
+				return nil, err
+			}
+			i, err := next()
+			if err != nil {
+				return nil, err
+			}
+			cd.Command = c
+			cd.Info = i
+		}
+	}
+
+	return rows, nil
+}
+
+// Pack compresses the 64 rows of channel data `rows` into the packed pattern, updating Length and Data
+// Only the parts of a channel that differ from EmptyChannelData are written
+func (p *PackedPattern) Pack(rows []PatternRow) error {
+	if len(rows) != patternRows {
+		return fmt.Errorf("a pattern must have exactly %d rows", patternRows)
+	}
+
+	packed := &bytes.Buffer{}
+	for r, row := range rows {
+		if len(row) > patternChannels {
+			return fmt.Errorf("row %d has too many channels", r)
+		}
+
+		for c, cd := range row {
+			what := PatternFlags(c)
+			var values []uint8
+			if cd.Note != EmptyNote || cd.Instrument != 0 {
+				what |= PatternFlagNote
+				values = append(values, uint8(cd.Note), cd.Instrument)
+			}
+			if cd.Volume != EmptyVolume {
+				what |= PatternFlagVolume
+				values = append(values, uint8(cd.Volume))
+			}
+			if cd.Command != 0 || cd.Info != 0 {
+				what |= PatternFlagCommand
+				values = append(values, cd.Command, cd.Info)
+			}
+
+			if len(values) == 0 {
+				continue
+			}
+
+			packed.WriteByte(uint8(what))
+			packed.Write(values)
+		}
+
+		// end of row
+		packed.WriteByte(0)
+	}
+
+	if packed.Len()+2 > 0xFFFF {
+		return errors.New("packed pattern data is too large")
+	}
+
+	p.Data = packed.Bytes()
+	p.Length = uint16(len(p.Data) + 2)
+	return nil
+}
+
 // PatternFlags is a flagset (and channel id) for data in the channel
 type PatternFlags uint8
 
@@ -0,0 +1,99 @@
+package s3m
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newEmptyRows() []PatternRow {
+	rows := make([]PatternRow, patternRows)
+	for r := range rows {
+		rows[r] = make(PatternRow, patternChannels)
+		for c := range rows[r] {
+			rows[r][c] = EmptyChannelData()
+		}
+	}
+	return rows
+}
+
+func TestPackUnpack(t *testing.T) {
+	rows := newEmptyRows()
+	// C-5 of instrument 1
+	rows[0][0].Note = 0x50
+	rows[0][0].Instrument = 1
+	// a volume on its own
+	rows[0][3].Volume = 32
+	// note stop with a volume and a command (A06)
+	rows[5][31] = ChannelData{Note: StopNote, Volume: 0, Command: 1, Info: 6}
+	// a command without info
+	rows[63][7].Command = 2
+
+	p := &PackedPattern{}
+	if err := p.Pack(rows); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0x20, 0x50, 0x01, 0x43, 32, 0}
+	if !bytes.HasPrefix(p.Data, expected) {
+		t.Errorf("unexpected packed data of the first row % x", p.Data[:len(expected)])
+	}
+	if int(p.Length) != len(p.Data)+2 {
+		t.Errorf("unexpected length %d for %d bytes of packed data", p.Length, len(p.Data))
+	}
+
+	unpacked, err := p.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unpacked) != patternRows {
+		t.Fatalf("unexpected number of rows %d", len(unpacked))
+	}
+	for r := range rows {
+		for c := range rows[r] {
+			cd := unpacked[r][c]
+			cd.What = 0
+			if cd != rows[r][c] {
+				t.Errorf("row %d, channel %d: unexpected channel data %+v", r, c, unpacked[r][c])
+			}
+		}
+	}
+	if what := unpacked[5][31].What; what != PatternFlagNote|PatternFlagVolume|PatternFlagCommand|31 {
+		t.Errorf("unexpected flags %#02x", what)
+	}
+}
+
+func TestPackEmptyRows(t *testing.T) {
+	p := &PackedPattern{}
+	if err := p.Pack(newEmptyRows()); err != nil {
+		t.Fatal(err)
+	}
+
+	// every row is terminated, even when it has nothing in it
+	if !bytes.Equal(p.Data, make([]byte, patternRows)) {
+		t.Errorf("unexpected packed data % x", p.Data)
+	}
+	if p.Length != patternRows+2 {
+		t.Errorf("unexpected length %d", p.Length)
+	}
+}
+
+func TestUnpackShortData(t *testing.T) {
+	// only the first two rows are stored, with an instrument on the second one
+	p := &PackedPattern{Data: []byte{0, 0x22, 0xFF, 0x02, 0}}
+	rows, err := p.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cd := rows[1][2]; cd.Note != EmptyNote || cd.Instrument != 2 || cd.Volume != EmptyVolume {
+		t.Errorf("unexpected channel data %+v", cd)
+	}
+	if cd := rows[63][2]; cd != EmptyChannelData() {
+		t.Errorf("unexpected channel data %+v in the last row", cd)
+	}
+
+	// the data ends before the instrument of the note
+	p = &PackedPattern{Data: []byte{0x20, 0x50}}
+	if _, err := p.Unpack(); err == nil {
+		t.Error("expected an error for packed data ending in the middle of a channel")
+	}
+}
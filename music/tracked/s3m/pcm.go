@@ -0,0 +1,34 @@
+package s3m
+
+import "github.com/gotracker/goaudiofile/music/pcm"
+
+// PCM converts the sample data of the instrument into a normalized sample
+// It returns nil when the instrument is not a PCM (Digiplayer) sample.
+func (s *SCRSFull) PCM() *pcm.Sample {
+	si, ok := s.Ancillary.(*SCRSDigiplayerHeader)
+	if !ok {
+		return nil
+	}
+
+	channels := 1
+	if si.Flags.IsStereo() {
+		channels = 2
+	}
+	bytesPerSample := si.frameSize() / channels
+
+	// stereo samples are stored as the left channel followed by the right channel
+	data := pcm.Interleave(s.SignedSample(), channels, bytesPerSample)
+
+	var p *pcm.Sample
+	if si.Flags.Is16BitSample() {
+		p = pcm.FromSigned16LE(data, channels)
+	} else {
+		p = pcm.FromSigned8(data, channels)
+	}
+
+	p.BaseFrequency = float64(si.C2Spd.Value())
+	if begin, end, ok := si.Loop(); ok {
+		p.Loop = pcm.NewLoop(pcm.LoopModeForward, int(begin), int(end), p.Frames())
+	}
+	return p
+}
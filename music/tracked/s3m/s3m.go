@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/gotracker/goaudiofile/internal/util"
@@ -19,16 +20,62 @@ type File struct {
 	Panning            [32]PanningFlags
 	Instruments        []SCRSFull
 	Patterns           []PackedPattern
+	Unparsed           *Unparsed // only kept when reading with PreserveUnparsed
+}
+
+// Unparsed is the data of an S3M file that the other structures of File do not represent
+type Unparsed struct {
+	Gaps []Gap
+}
+
+// Gap is a range of file data that is not covered by any of the other structures of File
+type Gap struct {
+	Offset int
+	Data   []byte
 }
 
 // SCRSFull is a full SCRS header + sample data (if applicable)
 type SCRSFull struct {
 	SCRS
-	Sample []uint8
+	Sample []uint8 // unpacked PCM, stored as signed or unsigned values according to Signed
+	// Signed is set when Sample holds signed values (see ModuleHeader.IsSignedSamples)
+	// The writer converts the data if this does not match the convention of the file being written.
+	Signed bool
+	// Packing is how the sample data was stored in the file
+	// Packed data is decoded by the reader, and the writer always writes it back unpacked.
+	Packing Packing
+}
+
+// SignedSample returns the sample data as signed values, converting it if needed
+func (s *SCRSFull) SignedSample() []uint8 {
+	if s.Signed {
+		return s.Sample
+	}
+	return s.convertedSample(true)
+}
+
+// convertedSample returns the sample data using the signed/unsigned convention `signed`
+func (s *SCRSFull) convertedSample(signed bool) []uint8 {
+	if s.Signed == signed {
+		return s.Sample
+	}
+
+	first, step := 0, 1
+	if si, ok := s.Ancillary.(*SCRSDigiplayerHeader); ok && si.Flags.Is16BitSample() {
+		// only the high byte of each (little-endian) value holds the sign
+		first, step = 1, 2
+	}
+
+	out := append([]uint8{}, s.Sample...)
+	for i := first; i < len(out); i += step {
+		out[i] ^= 0x80
+	}
+	return out
 }
 
 // Read reads an S3M file from the reader `r` and creates an internal File representation
-func Read(r io.Reader) (*File, error) {
+func Read(r io.Reader, opts ...ReadOption) (*File, error) {
+	o := util.GetReadOptions(opts)
 	buffer := &bytes.Buffer{}
 	if _, err := buffer.ReadFrom(r); err != nil {
 		return nil, err
@@ -69,14 +116,27 @@ func Read(r io.Reader) (*File, error) {
 		}
 	}
 
+	var coverage *util.Coverage
+	if o.PreserveUnparsed {
+		coverage = util.NewCoverage(len(data))
+		coverage.Mark(0, len(data)-buffer.Len())
+	}
+
 	for _, ptr := range f.InstrumentPointers {
-		sample, err := readS3MSample(data, ptr)
+		sample, err := readS3MSample(data, ptr, fh.IsSignedSamples())
 		if err != nil {
 			return nil, err
 		}
 		if sample == nil {
 			continue
 		}
+		if coverage != nil {
+			coverage.Mark(ptr.Offset(), scrsSize)
+			if si, ok := sample.Ancillary.(*SCRSDigiplayerHeader); ok && !si.PackingScheme.IsADPCM() {
+				// packed data is kept as a gap, as the writer can't reproduce it
+				coverage.Mark(si.MemSeg.Offset(), len(sample.Sample))
+			}
+		}
 		f.Instruments = append(f.Instruments, *sample)
 	}
 
@@ -85,6 +145,9 @@ func Read(r io.Reader) (*File, error) {
 		if err != nil {
 			return nil, err
 		}
+		if pattern != nil && coverage != nil {
+			coverage.Mark(ptr.Offset(), int(pattern.Length))
+		}
 		if pattern == nil {
 			// empty pattern
 			p := PackedPattern{
@@ -97,10 +160,20 @@ func Read(r io.Reader) (*File, error) {
 		f.Patterns = append(f.Patterns, *pattern)
 	}
 
+	if coverage != nil {
+		f.Unparsed = &Unparsed{}
+		for _, g := range coverage.Gaps() {
+			f.Unparsed.Gaps = append(f.Unparsed.Gaps, Gap{
+				Offset: g.Offset,
+				Data:   append([]byte{}, data[g.Offset:g.Offset+g.Length]...),
+			})
+		}
+	}
+
 	return &f, nil
 }
 
-func readS3MSample(data []byte, ptr ParaPointer) (*SCRSFull, error) {
+func readS3MSample(data []byte, ptr ParaPointer, signed bool) (*SCRSFull, error) {
 	pos := ptr.Offset()
 	if pos >= len(data) {
 		return nil, errors.New("data out of range")
@@ -112,22 +185,31 @@ func readS3MSample(data []byte, ptr ParaPointer) (*SCRSFull, error) {
 	}
 
 	s := SCRSFull{
-		SCRS: *scrs,
+		SCRS:   *scrs,
+		Signed: signed,
 	}
 
 	switch si := s.Ancillary.(type) {
 	case *SCRSDigiplayerHeader:
-		numChannels := 1
-		if si.Flags.IsStereo() {
-			numChannels = 2
+		filePos := si.MemSeg.Offset()
+		if filePos > len(data) {
+			return nil, errors.New("sample data out of range")
 		}
-		bitsPerSample := 8
-		if si.Flags.Is16BitSample() {
-			bitsPerSample = 16
+		if si.PackingScheme == PackingDP30ADPCM {
+			return nil, errors.New("DP30 ADPCM packed sample data is not supported")
 		}
-		filePos := si.MemSeg.Offset()
-		dataLen := int(si.Length.Lo) * numChannels * bitsPerSample / 8
-		s.Sample = data[filePos : filePos+dataLen]
+		if si.PackingScheme.IsADPCM() {
+			s.Packing = si.PackingScheme
+			s.Sample = unpackADPCMSample(data[filePos:], int(si.Length.Value()), signed)
+			break
+		}
+		frameSize := si.frameSize()
+		frames := int(si.Length.Value())
+		if avail := (len(data) - filePos) / frameSize; frames > avail {
+			// the file is cut short, so keep all the whole frames that are there
+			frames = avail
+		}
+		s.Sample = data[filePos : filePos+frames*frameSize]
 
 	default:
 		// do nothing
@@ -136,6 +218,17 @@ func readS3MSample(data []byte, ptr ParaPointer) (*SCRSFull, error) {
 	return &s, nil
 }
 
+// unpackADPCMSample decodes ModPlug ADPCM packed (8-bit mono) sample data, using the file's signed/unsigned convention
+func unpackADPCMSample(data []byte, frames int, signed bool) []byte {
+	sample := util.DecodeADPCM4(data, frames)
+	if !signed {
+		for i := range sample {
+			sample[i] ^= 0x80
+		}
+	}
+	return sample
+}
+
 func readS3MPattern(data []byte, ptr ParaPointer) (*PackedPattern, error) {
 	pos := ptr.Offset()
 	if pos <= 0 {
@@ -150,3 +243,308 @@ func readS3MPattern(data []byte, ptr ParaPointer) (*PackedPattern, error) {
 
 	return &p, nil
 }
+
+const (
+	// scrsSize is the size of a single SCRS header block
+	scrsSize = 0x50
+	// maxParaPointer16 is the furthest offset reachable by a ParaPointer16
+	maxParaPointer16 = 0xFFFF << 4
+	// maxParaPointer24 is the furthest offset reachable by a ParaPointer24
+	maxParaPointer24 = 0xFFFFFF << 4
+)
+
+// fileLayout describes where the structures of a File are placed when writing
+type fileLayout struct {
+	head               ModuleHeader
+	orderList          []uint8
+	instrumentPointers []ParaPointer16
+	patternPointers    []ParaPointer16
+	sampleSegments     []ParaPointer24
+	sampleLengths      []HiLo32
+	size               int
+	gaps               []Gap
+	// keepPacked is set when packed sample data is left in the gaps instead of being written unpacked
+	keepPacked bool
+}
+
+// Write writes the internal S3M File representation `f` to the writer `w`
+// All parapointers (and the counts in the module header) are recalculated from the contents of `f`,
+// unless `f` was read with PreserveUnparsed and everything still fits where it was originally read from
+func Write(w io.Writer, f *File) error {
+	if f == nil {
+		return errors.New("f is nil")
+	}
+
+	if f.Unparsed != nil {
+		if l := f.preservedLayout(); l != nil {
+			data, err := f.encode(l)
+			if err == nil {
+				_, err = w.Write(data)
+				return err
+			}
+			if !errors.Is(err, util.ErrImageConflict) {
+				return err
+			}
+			// something no longer fits in its original place, so lay everything out from scratch
+		}
+	}
+
+	l, err := f.freshLayout()
+	if err != nil {
+		return err
+	}
+
+	data, err := f.encode(l)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (f *File) freshLayout() (*fileLayout, error) {
+	l := fileLayout{
+		head:               f.Head,
+		orderList:          f.OrderList,
+		instrumentPointers: make([]ParaPointer16, len(f.Instruments)),
+		patternPointers:    make([]ParaPointer16, len(f.Patterns)),
+		sampleSegments:     make([]ParaPointer24, len(f.Instruments)),
+		sampleLengths:      make([]HiLo32, len(f.Instruments)),
+	}
+
+	if len(l.orderList)&1 != 0 {
+		// ST3 expects an even number of orders
+		l.orderList = append(append([]uint8{}, l.orderList...), 0xFF)
+	}
+	l.head.OrderCount = uint16(len(l.orderList))
+	l.head.InstrumentCount = uint16(len(f.Instruments))
+	l.head.PatternCount = uint16(len(f.Patterns))
+	l.head.Special = 0
+
+	pos := l.tablesLength()
+
+	// lay out the blocks in the same order ST3 does: instruments, patterns, then sample data
+	for i := range f.Instruments {
+		pos = paragraphAlign(pos)
+		if pos > maxParaPointer16 {
+			return nil, errors.New("instrument data out of range")
+		}
+		l.instrumentPointers[i] = ParaPointer16(pos >> 4)
+		pos += scrsSize
+	}
+
+	for i, p := range f.Patterns {
+		pos = paragraphAlign(pos)
+		if pos > maxParaPointer16 {
+			return nil, errors.New("pattern data out of range")
+		}
+		l.patternPointers[i] = ParaPointer16(pos >> 4)
+		pos += 2 + len(p.Data)
+	}
+
+	for i, inst := range f.Instruments {
+		si, ok := inst.Ancillary.(*SCRSDigiplayerHeader)
+		if !ok {
+			continue
+		}
+
+		length, err := sampleLength(si, inst.Sample)
+		if err != nil {
+			return nil, fmt.Errorf("instrument %d: %w", i+1, err)
+		}
+		l.sampleLengths[i] = length
+
+		if len(inst.Sample) > 0 {
+			pos = paragraphAlign(pos)
+			if pos > maxParaPointer24 {
+				return nil, errors.New("sample data out of range")
+			}
+			seg := pos >> 4
+			l.sampleSegments[i] = ParaPointer24{
+				Hi: uint8(seg >> 16),
+				Lo: ParaPointer16(seg),
+			}
+			pos += len(inst.Sample)
+		}
+	}
+
+	l.size = paragraphAlign(pos)
+	return &l, nil
+}
+
+// preservedLayout returns the layout the File was originally read with, or nil if it cannot be used anymore
+func (f *File) preservedLayout() *fileLayout {
+	if len(f.InstrumentPointers) != len(f.Instruments) || len(f.PatternPointers) != len(f.Patterns) {
+		return nil
+	}
+
+	l := fileLayout{
+		head:               f.Head,
+		orderList:          f.OrderList,
+		instrumentPointers: f.InstrumentPointers,
+		patternPointers:    f.PatternPointers,
+		sampleSegments:     make([]ParaPointer24, len(f.Instruments)),
+		sampleLengths:      make([]HiLo32, len(f.Instruments)),
+		gaps:               f.Unparsed.Gaps,
+		keepPacked:         true,
+	}
+	l.head.OrderCount = uint16(len(l.orderList))
+	l.head.InstrumentCount = uint16(len(f.Instruments))
+	l.head.PatternCount = uint16(len(f.Patterns))
+
+	for i, ptr := range l.patternPointers {
+		if ptr == 0 && !f.Patterns[i].isEmpty() {
+			// the pattern was empty, but now has nowhere to go
+			return nil
+		}
+	}
+
+	for i, inst := range f.Instruments {
+		si, ok := inst.Ancillary.(*SCRSDigiplayerHeader)
+		if !ok {
+			continue
+		}
+
+		l.sampleSegments[i] = si.MemSeg
+		if si.PackingScheme.IsADPCM() {
+			// the packed data is kept in the gaps, but only while it still decodes to the sample data
+			if !f.Unparsed.isPackedSampleCurrent(si, inst.Sample, inst.Signed) {
+				return nil
+			}
+			l.sampleLengths[i] = si.Length
+			continue
+		}
+
+		length, err := sampleLength(si, inst.Sample)
+		if err != nil {
+			return nil
+		}
+		l.sampleLengths[i] = length
+	}
+
+	return &l
+}
+
+// isPackedSampleCurrent returns true when the packed sample data kept in the gaps still decodes to `sample`
+func (u *Unparsed) isPackedSampleCurrent(si *SCRSDigiplayerHeader, sample []uint8, signed bool) bool {
+	if len(sample) != int(si.Length.Value()) {
+		return false
+	}
+
+	ofs := si.MemSeg.Offset()
+	for _, g := range u.Gaps {
+		if ofs < g.Offset || ofs >= g.Offset+len(g.Data) {
+			continue
+		}
+		return bytes.Equal(unpackADPCMSample(g.Data[ofs-g.Offset:], len(sample), signed), sample)
+	}
+	return false
+}
+
+// tablesLength returns the size of the module header and the tables that follow it
+func (l *fileLayout) tablesLength() int {
+	n := 0x60 + len(l.orderList) + len(l.instrumentPointers)*2 + len(l.patternPointers)*2
+	if l.head.DefaultPanValueFlag == 0xFC {
+		n += 32
+	}
+	return n
+}
+
+func (f *File) encode(l *fileLayout) ([]byte, error) {
+	im := &util.Image{}
+	for _, g := range l.gaps {
+		if err := im.Place(g.Offset, g.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	tables := &bytes.Buffer{}
+	if err := WriteModuleHeader(tables, &l.head); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, &f.ChannelSettings); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, l.orderList); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, l.instrumentPointers); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(tables, binary.LittleEndian, l.patternPointers); err != nil {
+		return nil, err
+	}
+	if l.head.DefaultPanValueFlag == 0xFC {
+		if err := binary.Write(tables, binary.LittleEndian, &f.Panning); err != nil {
+			return nil, err
+		}
+	}
+	if err := im.Place(0, tables.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for i, inst := range f.Instruments {
+		scrs := inst.SCRS
+		si, isDigi := scrs.Ancillary.(*SCRSDigiplayerHeader)
+		if isDigi {
+			d := *si
+			d.MemSeg = l.sampleSegments[i]
+			d.Length = l.sampleLengths[i]
+			if !l.keepPacked {
+				d.PackingScheme = PackingUnpacked
+			}
+			scrs.Ancillary = &d
+			si = &d
+		}
+
+		buf := &bytes.Buffer{}
+		if err := WriteSCRS(buf, &scrs); err != nil {
+			return nil, err
+		}
+		if buf.Len() > scrsSize {
+			return nil, fmt.Errorf("instrument %d header is too large", i+1)
+		}
+		if err := im.Place(l.instrumentPointers[i].Offset(), buf.Bytes()); err != nil {
+			return nil, err
+		}
+
+		if isDigi && len(inst.Sample) > 0 && !si.PackingScheme.IsADPCM() {
+			sample := inst.convertedSample(l.head.IsSignedSamples())
+			if err := im.Place(l.sampleSegments[i].Offset(), sample); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i, p := range f.Patterns {
+		ptr := l.patternPointers[i]
+		if ptr == 0 {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		if err := binary.Write(buf, binary.LittleEndian, uint16(2+len(p.Data))); err != nil {
+			return nil, err
+		}
+		buf.Write(p.Data)
+		if err := im.Place(ptr.Offset(), buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	im.Grow(l.size)
+	return im.Bytes(), nil
+}
+
+// sampleLength returns the length (in frames) of the sample data
+func sampleLength(si *SCRSDigiplayerHeader, sample []uint8) (HiLo32, error) {
+	frameSize := si.frameSize()
+	if len(sample)%frameSize != 0 {
+		return HiLo32{}, errors.New("partial sample frame")
+	}
+	return NewHiLo32(uint32(len(sample) / frameSize)), nil
+}
+
+func paragraphAlign(pos int) int {
+	return (pos + 0x0F) &^ 0x0F
+}
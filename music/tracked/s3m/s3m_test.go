@@ -0,0 +1,191 @@
+package s3m
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/gotracker/goaudiofile/internal/testutil"
+)
+
+// newTestFile creates a two channel file with a digital sample, an empty instrument and two patterns
+func newTestFile() *File {
+	f := &File{}
+	copy(f.Head.Name[:], "test song")
+	f.Head.Type = 16
+	copy(f.Head.SCRM[:], "SCRM")
+	f.Head.TrackerVersion = 0x1320
+	f.Head.FileFormatInformation = 2
+	f.Head.GlobalVolume = 64
+	f.Head.InitialSpeed = 6
+	f.Head.InitialTempo = 125
+	f.Head.MixingVolume = 0xB0
+	f.Head.DefaultPanValueFlag = 0xFC
+	for i := range f.ChannelSettings {
+		f.ChannelSettings[i] = 0xFF
+		f.Panning[i] = PanningFlags(0x20 | i&15)
+	}
+	f.ChannelSettings[0] = 0
+	f.ChannelSettings[1] = 8
+	f.OrderList = []uint8{0, 1, 0}
+
+	d := &SCRSDigiplayerHeader{Volume: 64, Flags: SCRSFlags16Bit, C2Spd: HiLo32{Lo: 8363}}
+	copy(d.SCRS[:], "SCRS")
+	copy(d.SampleName[:], "test sample")
+	n := &SCRSNoneHeader{}
+	copy(n.SampleName[:], "empty")
+	f.Instruments = []SCRSFull{
+		{SCRS: SCRS{Head: SCRSHeader{Type: SCRSTypeDigiplayer}, Ancillary: d}, Sample: []byte{1, 2, 3, 4, 5, 6}},
+		{SCRS: SCRS{Head: SCRSHeader{Type: SCRSTypeNone}, Ancillary: n}},
+	}
+
+	f.Patterns = []PackedPattern{
+		// C-3 of instrument 1 on the first channel of the first row
+		{Data: append([]byte{0x20, 0x31, 0x01}, make([]byte, 64)...)},
+		{Data: make([]byte, 64)},
+	}
+	return f
+}
+
+// buildTestFile writes the file created by newTestFile
+func buildTestFile(t *testing.T) []byte {
+	return writeTestFile(t, newTestFile())
+}
+
+func writeTestFile(t *testing.T, f *File) []byte {
+	out := &bytes.Buffer{}
+	if err := Write(out, f); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func readPreserved(r io.Reader) (*File, error) {
+	return Read(r, PreserveUnparsed())
+}
+
+func TestPreserveUnparsedRoundTrip(t *testing.T) {
+	data := buildTestFile(t)
+
+	// fill in the parts of the file that the structures don't cover
+	data[0x3E], data[0x3F] = 0x34, 0x12 // Special
+	for i := 0x60 + 4 + 4 + 4 + 32; i < 0x90; i++ {
+		// the padding between the panning table and the first instrument
+		data[i] = 0xEE
+	}
+	data = append(data, "trailing data"...)
+
+	f := testutil.RoundTrip(t, data, readPreserved, Write)
+
+	if len(f.Instruments) != 2 || len(f.Patterns) != 2 {
+		t.Fatalf("unexpected file contents")
+	}
+	if !bytes.Equal(f.Instruments[0].Sample, []byte{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("unexpected sample data % x", f.Instruments[0].Sample)
+	}
+}
+
+// buildADPCMTestFile builds the test file with the digital sample packed as ModPlug ADPCM using `packing`
+func buildADPCMTestFile(t *testing.T, packing Packing) []byte {
+	// a delta table, followed by the nibbles 1, 2, 15 and 9
+	packed := []byte{
+		0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40,
+		0xFF, 0xFE, 0xFC, 0xF8, 0xF0, 0xE0, 0xD0, 0xC0,
+		0x21, 0x9F,
+	}
+
+	// write the packed data as if it were an unpacked 8-bit sample,
+	// then turn the sample header into the one of a packed sample
+	f := newTestFile()
+	d := f.Instruments[0].Ancillary.(*SCRSDigiplayerHeader)
+	d.Flags = 0
+	f.Instruments[0].Sample = packed
+	data := writeTestFile(t, f)
+
+	hdr := bytes.Index(data, []byte("SCRS")) - 0x4C
+	data[hdr+0x1E] = uint8(packing)
+	binary.LittleEndian.PutUint32(data[hdr+0x10:], 4)
+	return data
+}
+
+func TestPreserveADPCMSample(t *testing.T) {
+	data := buildADPCMTestFile(t, PackingModPlugADPCM)
+
+	f := testutil.RoundTrip(t, data, readPreserved, Write)
+
+	if f.Instruments[0].Packing != PackingModPlugADPCM {
+		t.Errorf("unexpected packing %d", f.Instruments[0].Packing)
+	}
+	// the file stores unsigned samples
+	if s := f.Instruments[0].Sample; !bytes.Equal(s, []byte{0x81, 0x83, 0x43, 0x41}) {
+		t.Errorf("unexpected sample data % x", s)
+	}
+}
+
+func TestReadDP30ADPCMSample(t *testing.T) {
+	data := buildADPCMTestFile(t, PackingDP30ADPCM)
+
+	if _, err := Read(bytes.NewReader(data)); err == nil {
+		t.Error("expected an error for DP30 ADPCM packed sample data")
+	}
+}
+
+func TestSignedSample(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		flags    SCRSFlags
+		signed   bool
+		data     []byte
+		expected []byte
+	}{
+		{"unsigned 8-bit", 0, false, []byte{0x80, 0xFF, 0x00}, []byte{0x00, 0x7F, 0x80}},
+		// only the high byte of each little-endian value changes
+		{"unsigned 16-bit", SCRSFlags16Bit, false, []byte{0x00, 0x80, 0x34, 0x12}, []byte{0x00, 0x00, 0x34, 0x92}},
+		{"signed 8-bit", 0, true, []byte{0x80, 0xFF}, []byte{0x80, 0xFF}},
+	} {
+		s := &SCRSFull{
+			SCRS:   SCRS{Ancillary: &SCRSDigiplayerHeader{Flags: tc.flags}},
+			Sample: tc.data,
+			Signed: tc.signed,
+		}
+		orig := append([]byte{}, tc.data...)
+		if out := s.SignedSample(); !bytes.Equal(out, tc.expected) {
+			t.Errorf("%s: unexpected sample data % x", tc.name, out)
+		}
+		if !bytes.Equal(s.Sample, orig) {
+			t.Errorf("%s: the sample data was modified", tc.name)
+		}
+	}
+}
+
+func TestWriteLongSample(t *testing.T) {
+	// a signed sample of more than 64K frames, written to a file that stores unsigned samples
+	sample := make([]byte, 0x10010)
+	for i := range sample {
+		sample[i] = uint8(i)
+	}
+	f := newTestFile()
+	f.Instruments[0].Ancillary.(*SCRSDigiplayerHeader).Flags = 0
+	f.Instruments[0].Sample = sample
+	f.Instruments[0].Signed = true
+
+	g, err := Read(bytes.NewReader(writeTestFile(t, f)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &g.Instruments[0]
+	if l := s.Ancillary.(*SCRSDigiplayerHeader).Length.Value(); l != uint32(len(sample)) {
+		t.Errorf("unexpected length %#x", l)
+	}
+	if s.Signed {
+		t.Error("expected unsigned sample data")
+	}
+	if len(s.Sample) != len(sample) || s.Sample[0x10001] != 0x81 {
+		t.Fatalf("unexpected sample data")
+	}
+	if !bytes.Equal(s.SignedSample(), sample) {
+		t.Error("unexpected signed sample data")
+	}
+}
@@ -0,0 +1,140 @@
+package xm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/gotracker/goaudiofile/music/tracked/it/block"
+)
+
+const (
+	// chunkHeaderLen is the size of the identifier and length of each chunk that OpenMPT writes after the sample data
+	chunkHeaderLen = 4 + 4
+)
+
+// nextChunk returns the identifier and the whole chunk (including its header) starting at `pos`,
+// and where the chunk after it starts
+func nextChunk(data []byte, pos int) (string, []byte, int, bool) {
+	if pos+chunkHeaderLen > len(data) {
+		return "", nil, pos, false
+	}
+	size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+	end := pos + chunkHeaderLen + size
+	if size < 0 || end > len(data) {
+		return "", nil, pos, false
+	}
+	return string(data[pos : pos+4]), data[pos:end], end, true
+}
+
+// readChunks reads the chunks that OpenMPT writes after the last sample, in the order it writes them:
+// the song message, the MIDI configuration, the pattern and channel names, the plugins and then
+// the XTPM and STPM blocks
+// Reading stops at the first chunk that isn't recognized, and the number of bytes read is returned.
+func (f *File) readChunks(data []byte) (int, error) {
+	pos := 0
+
+	if id, chunk, next, ok := nextChunk(data, pos); ok && id == "text" {
+		f.Message = append([]byte{}, chunk[chunkHeaderLen:]...)
+		pos = next
+	}
+
+	if id, chunk, next, ok := nextChunk(data, pos); ok && id == "MIDI" {
+		// older versions may have written a shorter configuration
+		cfg := make([]byte, block.MIDIConfigSize)
+		copy(cfg, chunk[chunkHeaderLen:])
+		f.MIDIConfig = &block.MIDIConfig{}
+		if err := binary.Read(bytes.NewReader(cfg), binary.LittleEndian, f.MIDIConfig); err != nil {
+			return 0, err
+		}
+		pos = next
+	}
+
+	for _, name := range []string{"PNAM", "CNAM"} {
+		if id, chunk, next, ok := nextChunk(data, pos); ok && id == name {
+			f.Blocks = append(f.Blocks, readBlock(chunk))
+			pos = next
+		}
+	}
+
+	for {
+		id, chunk, next, ok := nextChunk(data, pos)
+		if !ok || (id != "CHFX" && id[:2] != "FX") {
+			break
+		}
+		f.Blocks = append(f.Blocks, readBlock(chunk))
+		pos = next
+	}
+
+	exts, n := block.ReadExtensions(data[pos:], int(f.Head.NumInstruments))
+	f.Extensions = exts
+	pos += n
+
+	return pos, nil
+}
+
+// readBlock reads the chunk `chunk` into the matching block type
+// Chunks that can't be read completely are kept as Unknown blocks, so that no data is lost.
+func readBlock(chunk []byte) block.Block {
+	b, err := block.Read(chunk)
+	if err == nil && block.ParsedLength(b) == len(chunk) {
+		return b
+	}
+
+	p := block.Unknown{
+		Data: append([]byte{}, chunk[chunkHeaderLen:]...),
+	}
+	copy(p.Identifier[:], chunk)
+	p.BlockLen = uint32(len(p.Data))
+	return &p
+}
+
+// writeChunks writes the song message, MIDI configuration, blocks and extensions of `f` as OpenMPT does
+// If `keepLen` is set, the original lengths of the pattern and channel name blocks are kept.
+func writeChunks(w io.Writer, f *File, keepLen bool) error {
+	if len(f.Message) > 0 {
+		if err := writeChunk(w, [4]byte{'t', 'e', 'x', 't'}, f.Message); err != nil {
+			return err
+		}
+	}
+
+	if f.MIDIConfig != nil {
+		cfg := &bytes.Buffer{}
+		if err := binary.Write(cfg, binary.LittleEndian, f.MIDIConfig); err != nil {
+			return err
+		}
+		if err := writeChunk(w, [4]byte{'M', 'I', 'D', 'I'}, cfg.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range f.Blocks {
+		if err := block.Write(w, b, keepLen); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range f.Extensions {
+		if err := block.Write(w, b, keepLen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeChunk(w io.Writer, id [4]byte, body []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, id); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(body))); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	return nil
+}
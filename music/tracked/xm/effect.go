@@ -0,0 +1,163 @@
+package xm
+
+// Effect is an effect command of the pattern data
+// Effects 0x00-0x09 are shown as 0-9 and the rest as letters, so 0x0A is A, 0x10 is G and so on.
+type Effect uint8
+
+const (
+	// EffectArpeggio (0xy) alternates between the note and the notes x and y semitones above it
+	EffectArpeggio = Effect(0x00)
+	// EffectPortamentoUp (1xx) slides the pitch up
+	EffectPortamentoUp = Effect(0x01)
+	// EffectPortamentoDown (2xx) slides the pitch down
+	EffectPortamentoDown = Effect(0x02)
+	// EffectTonePortamento (3xx) slides the pitch towards the note
+	EffectTonePortamento = Effect(0x03)
+	// EffectVibrato (4xy) performs a vibrato with speed x and depth y
+	EffectVibrato = Effect(0x04)
+	// EffectTonePortamentoVolumeSlide (5xy) continues the tone portamento while sliding the volume
+	EffectTonePortamentoVolumeSlide = Effect(0x05)
+	// EffectVibratoVolumeSlide (6xy) continues the vibrato while sliding the volume
+	EffectVibratoVolumeSlide = Effect(0x06)
+	// EffectTremolo (7xy) performs a tremolo with speed x and depth y
+	EffectTremolo = Effect(0x07)
+	// EffectSetPanning (8xx) sets the panning position
+	EffectSetPanning = Effect(0x08)
+	// EffectSampleOffset (9xx) starts the sample at xx * 256 frames
+	EffectSampleOffset = Effect(0x09)
+	// EffectVolumeSlide (Axy) slides the volume up by x or down by y
+	EffectVolumeSlide = Effect(0x0A)
+	// EffectPositionJump (Bxx) jumps to order xx
+	EffectPositionJump = Effect(0x0B)
+	// EffectSetVolume (Cxx) sets the volume
+	EffectSetVolume = Effect(0x0C)
+	// EffectPatternBreak (Dxx) jumps to row xx (in decimal) of the next pattern
+	EffectPatternBreak = Effect(0x0D)
+	// EffectExtended (Exy) is one of the extended commands selected by x (see ExtendedEffect)
+	EffectExtended = Effect(0x0E)
+	// EffectSetSpeedTempo (Fxx) sets the speed (below 0x20) or the tempo
+	EffectSetSpeedTempo = Effect(0x0F)
+	// EffectSetGlobalVolume (Gxx) sets the global volume
+	EffectSetGlobalVolume = Effect(0x10)
+	// EffectGlobalVolumeSlide (Hxy) slides the global volume up by x or down by y
+	EffectGlobalVolumeSlide = Effect(0x11)
+	// EffectKeyOff (Kxx) releases the note at tick xx
+	EffectKeyOff = Effect(0x14)
+	// EffectSetEnvelopePosition (Lxx) sets the position of the volume envelope
+	EffectSetEnvelopePosition = Effect(0x15)
+	// EffectPanningSlide (Pxy) slides the panning right by x or left by y
+	EffectPanningSlide = Effect(0x19)
+	// EffectMultiRetrig (Rxy) retriggers the note every y ticks, changing the volume as selected by x
+	EffectMultiRetrig = Effect(0x1B)
+	// EffectTremor (Txy) turns the volume on for x+1 ticks and off for y+1 ticks
+	EffectTremor = Effect(0x1D)
+	// EffectExtraFinePortamento (Xxy) is one of the extra fine portamentos selected by x (see ExtraFineEffect)
+	EffectExtraFinePortamento = Effect(0x21)
+	// EffectPanbrello (Yxy) performs a panbrello with speed x and depth y (OpenMPT)
+	EffectPanbrello = Effect(0x22)
+	// EffectMIDIMacro (Zxx) sends a MIDI macro (OpenMPT)
+	EffectMIDIMacro = Effect(0x23)
+)
+
+// String returns the effect the way trackers display it
+func (e Effect) String() string {
+	switch {
+	case e < 10:
+		return string(rune('0' + e))
+	case e < 36:
+		return string(rune('A' + e - 10))
+	default:
+		return "?"
+	}
+}
+
+// ExtendedEffect is an extended command of the Exy effect
+type ExtendedEffect uint8
+
+const (
+	// ExtendedEffectAmigaFilter (E0x) turns the Amiga filter on or off (ignored by FastTracker 2)
+	ExtendedEffectAmigaFilter = ExtendedEffect(0x0)
+	// ExtendedEffectFinePortamentoUp (E1x) slides the pitch up once
+	ExtendedEffectFinePortamentoUp = ExtendedEffect(0x1)
+	// ExtendedEffectFinePortamentoDown (E2x) slides the pitch down once
+	ExtendedEffectFinePortamentoDown = ExtendedEffect(0x2)
+	// ExtendedEffectGlissandoControl (E3x) makes tone portamentos slide by whole semitones
+	ExtendedEffectGlissandoControl = ExtendedEffect(0x3)
+	// ExtendedEffectVibratoWaveform (E4x) sets the vibrato waveform
+	ExtendedEffectVibratoWaveform = ExtendedEffect(0x4)
+	// ExtendedEffectSetFinetune (E5x) sets the finetune of the note
+	ExtendedEffectSetFinetune = ExtendedEffect(0x5)
+	// ExtendedEffectPatternLoop (E6x) sets the loop start (x = 0) or loops x times
+	ExtendedEffectPatternLoop = ExtendedEffect(0x6)
+	// ExtendedEffectTremoloWaveform (E7x) sets the tremolo waveform
+	ExtendedEffectTremoloWaveform = ExtendedEffect(0x7)
+	// ExtendedEffectSetPanning (E8x) sets the (coarse) panning position
+	ExtendedEffectSetPanning = ExtendedEffect(0x8)
+	// ExtendedEffectRetrigger (E9x) retriggers the note every x ticks
+	ExtendedEffectRetrigger = ExtendedEffect(0x9)
+	// ExtendedEffectFineVolumeSlideUp (EAx) slides the volume up once
+	ExtendedEffectFineVolumeSlideUp = ExtendedEffect(0xA)
+	// ExtendedEffectFineVolumeSlideDown (EBx) slides the volume down once
+	ExtendedEffectFineVolumeSlideDown = ExtendedEffect(0xB)
+	// ExtendedEffectNoteCut (ECx) cuts the note at tick x
+	ExtendedEffectNoteCut = ExtendedEffect(0xC)
+	// ExtendedEffectNoteDelay (EDx) delays the note until tick x
+	ExtendedEffectNoteDelay = ExtendedEffect(0xD)
+	// ExtendedEffectPatternDelay (EEx) repeats the row x times
+	ExtendedEffectPatternDelay = ExtendedEffect(0xE)
+	// ExtendedEffectSetActiveMacro (EFx) selects the MIDI macro used by Zxx (OpenMPT)
+	ExtendedEffectSetActiveMacro = ExtendedEffect(0xF)
+)
+
+// ExtraFineEffect is a sub-command of the Xxy effect
+type ExtraFineEffect uint8
+
+const (
+	// ExtraFineEffectPortamentoUp (X1x) slides the pitch up once, by a quarter of a fine portamento
+	ExtraFineEffectPortamentoUp = ExtraFineEffect(0x1)
+	// ExtraFineEffectPortamentoDown (X2x) slides the pitch down once, by a quarter of a fine portamento
+	ExtraFineEffectPortamentoDown = ExtraFineEffect(0x2)
+)
+
+// EffectCommand is an effect together with its parameter
+type EffectCommand struct {
+	Effect    Effect
+	Parameter uint8
+}
+
+// XY returns the high and low nibbles of the parameter
+func (e EffectCommand) XY() (uint8, uint8) {
+	return e.Parameter >> 4, e.Parameter & 0x0F
+}
+
+// Extended returns the extended command and its value, if the effect is Exy
+func (e EffectCommand) Extended() (ExtendedEffect, uint8, bool) {
+	if e.Effect != EffectExtended {
+		return 0, 0, false
+	}
+	x, y := e.XY()
+	return ExtendedEffect(x), y, true
+}
+
+// ExtraFine returns the extra fine portamento command and its value, if the effect is Xxy
+func (e EffectCommand) ExtraFine() (ExtraFineEffect, uint8, bool) {
+	if e.Effect != EffectExtraFinePortamento {
+		return 0, 0, false
+	}
+	x, y := e.XY()
+	return ExtraFineEffect(x), y, true
+}
+
+// IsEmpty returns true if the command does nothing
+// An arpeggio without a parameter has no effect, so it is what an empty effect column holds.
+func (e EffectCommand) IsEmpty() bool {
+	return e.Effect == EffectArpeggio && e.Parameter == 0
+}
+
+// GetEffect returns the effect and parameter of the channel
+func (f ChannelData) GetEffect() EffectCommand {
+	return EffectCommand{
+		Effect:    Effect(f.Effect),
+		Parameter: f.EffectParameter,
+	}
+}
@@ -0,0 +1,52 @@
+package xm
+
+import "testing"
+
+func TestEffectString(t *testing.T) {
+	for _, tc := range []struct {
+		effect   Effect
+		expected string
+	}{
+		{EffectArpeggio, "0"},
+		{EffectSampleOffset, "9"},
+		{EffectVolumeSlide, "A"},
+		{EffectSetSpeedTempo, "F"},
+		{EffectSetGlobalVolume, "G"},
+		{EffectKeyOff, "K"},
+		{EffectPanningSlide, "P"},
+		{EffectMultiRetrig, "R"},
+		{EffectTremor, "T"},
+		{EffectExtraFinePortamento, "X"},
+		{EffectMIDIMacro, "Z"},
+		{Effect(36), "?"},
+	} {
+		if s := tc.effect.String(); s != tc.expected {
+			t.Errorf("effect %#02x: unexpected string %q, expected %q", uint8(tc.effect), s, tc.expected)
+		}
+	}
+}
+
+func TestEffectCommand(t *testing.T) {
+	e := (ChannelData{Effect: uint8(EffectExtended), EffectParameter: 0xC3}).GetEffect()
+	if x, y := e.XY(); x != 0xC || y != 3 {
+		t.Errorf("unexpected parameter nibbles %x and %x", x, y)
+	}
+	if cmd, v, ok := e.Extended(); !ok || cmd != ExtendedEffectNoteCut || v != 3 {
+		t.Errorf("unexpected extended command %x%x (%v)", cmd, v, ok)
+	}
+	if _, _, ok := e.ExtraFine(); ok {
+		t.Error("an extended command is not an extra fine portamento")
+	}
+
+	e = EffectCommand{Effect: EffectExtraFinePortamento, Parameter: 0x24}
+	if cmd, v, ok := e.ExtraFine(); !ok || cmd != ExtraFineEffectPortamentoDown || v != 4 {
+		t.Errorf("unexpected extra fine portamento %x%x (%v)", cmd, v, ok)
+	}
+	if _, _, ok := e.Extended(); ok {
+		t.Error("an extra fine portamento is not an extended command")
+	}
+
+	if !(EffectCommand{}).IsEmpty() || (EffectCommand{Effect: EffectArpeggio, Parameter: 0x37}).IsEmpty() {
+		t.Error("only an arpeggio without a parameter is empty")
+	}
+}
@@ -6,6 +6,18 @@ import (
 	"io"
 
 	"github.com/gotracker/goaudiofile/internal/util"
+	"github.com/gotracker/goaudiofile/music/pcm"
+)
+
+const (
+	// xmInstrumentHeaderSize is the size of the instrument header (up to the sample headers) when it has samples
+	xmInstrumentHeaderSize = 263
+	// xmInstrumentHeaderShortSize is the size of the instrument header when it has no samples
+	xmInstrumentHeaderShortSize = 29
+	// xmSampleHeaderSize is the size of a single sample header
+	xmSampleHeaderSize = 40
+	// sampleADPCMMarker is the ReservedP17 value ModPlug Tracker uses to mark ADPCM packed samples
+	sampleADPCMMarker = 0xAD
 )
 
 // InstrumentHeader is a representation of the XM file instrument header
@@ -37,6 +49,7 @@ type InstrumentHeader struct {
 	VolumeFadeout     uint16
 	ReservedP241      [11]uint16
 
+	Extra   []byte // bytes beyond the fields understood by the reader
 	Samples []SampleHeader
 }
 
@@ -90,7 +103,9 @@ type SampleHeader struct {
 	RelativeNoteNumber int8
 	ReservedP17        uint8
 	Name               [22]uint8
+	Extra              []byte // bytes beyond the fields understood by the reader
 	SampleData         []uint8
+	PackedData         []uint8 // the original ADPCM packed sample data (see PreserveUnparsed)
 }
 
 // GetName returns a string representation of the data stored in the Name field
@@ -98,6 +113,88 @@ func (sh *SampleHeader) GetName() string {
 	return util.GetString(sh.Name[:])
 }
 
+// IsADPCM returns true if the sample data is stored as ModPlug 4-bit ADPCM
+func (sh *SampleHeader) IsADPCM() bool {
+	return sh.ReservedP17 == sampleADPCMMarker && !sh.Flags.Is16Bit()
+}
+
+// FrameSize returns the number of bytes used by each sample frame (all channels of a single sample point)
+func (sh *SampleHeader) FrameSize() int {
+	n := 1
+	if sh.Flags.Is16Bit() {
+		n *= 2
+	}
+	if sh.Flags.IsStereo() {
+		n *= 2
+	}
+	return n
+}
+
+// Frames returns the length of the sample in sample frames
+// The Length field in the header is stored in bytes.
+func (sh *SampleHeader) Frames() uint32 {
+	return sh.Length / uint32(sh.FrameSize())
+}
+
+// LoopStartFrame returns the loop start of the sample in sample frames
+func (sh *SampleHeader) LoopStartFrame() uint32 {
+	return sh.LoopStart / uint32(sh.FrameSize())
+}
+
+// LoopLengthFrames returns the loop length of the sample in sample frames
+func (sh *SampleHeader) LoopLengthFrames() uint32 {
+	return sh.LoopLength / uint32(sh.FrameSize())
+}
+
+// Loop returns the loop start and end (in sample frames) and whether the sample has a usable loop
+// A loop is only usable when the loop mode is enabled or ping-pong and it has a length within the sample.
+func (sh *SampleHeader) Loop() (uint32, uint32, bool) {
+	switch sh.Flags.LoopMode() {
+	case SampleLoopModeEnabled, SampleLoopModePingPong:
+	default:
+		return 0, 0, false
+	}
+
+	begin := sh.LoopStartFrame()
+	end := begin + sh.LoopLengthFrames()
+	frames := sh.Frames()
+	if end > frames {
+		end = frames
+	}
+	if begin >= end {
+		return 0, 0, false
+	}
+	return begin, end, true
+}
+
+// InterleavedData returns the sample data as signed little-endian PCM with the channels of stereo samples interleaved
+// SampleData holds stereo samples the way they are stored in the file: the left channel followed by the right channel.
+func (sh *SampleHeader) InterleavedData() []uint8 {
+	if !sh.Flags.IsStereo() {
+		return sh.SampleData
+	}
+
+	return pcm.Interleave(sh.SampleData, 2, sh.FrameSize()/2)
+}
+
+// SetInterleavedData replaces the sample data with the signed little-endian PCM `pcm`, which has the channels of stereo
+// samples interleaved (see InterleavedData)
+func (sh *SampleHeader) SetInterleavedData(pcm []uint8) {
+	if !sh.Flags.IsStereo() {
+		sh.SampleData = pcm
+		return
+	}
+
+	bytesPerSample := sh.FrameSize() / 2
+	sh.SampleData = make([]uint8, len(pcm))
+	channels := sampleChannels(sh.SampleData, sh.Flags)
+	for c, data := range channels {
+		for i := 0; i+bytesPerSample <= len(data); i += bytesPerSample {
+			copy(data[i:i+bytesPerSample], pcm[i*2+c*bytesPerSample:])
+		}
+	}
+}
+
 // SampleFlags is a representation of the XM file sample flags
 type SampleFlags uint8
 
@@ -140,197 +237,197 @@ const (
 	SampleLoopModeUnknown = SampleLoopMode(0x03)
 )
 
-func readInstrumentHeaderPartial(r io.Reader) (*InstrumentHeader, error) {
+func readInstrumentHeaderPartial(r io.Reader) (*InstrumentHeader, uint32, error) {
 	ih := InstrumentHeader{}
 
 	sz := uint32(0)
 	if err := binary.Read(r, binary.LittleEndian, &ih.Size); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	sz += 4
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.Name); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	sz += 22
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.Type); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	sz++
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.SamplesCount); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.SampleHeaderSize); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 4; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	for i := range ih.SampleNumber {
 		if err := binary.Read(r, binary.LittleEndian, &ih.SampleNumber[i]); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz++; sz >= ih.Size {
-			return &ih, nil
+			return &ih, sz, nil
 		}
 	}
 
 	for i := range ih.VolEnv {
 		if err := binary.Read(r, binary.LittleEndian, &ih.VolEnv[i].X); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz += 2; sz >= ih.Size {
-			return &ih, nil
+			return &ih, sz, nil
 		}
 		if err := binary.Read(r, binary.LittleEndian, &ih.VolEnv[i].Y); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz += 2; sz >= ih.Size {
-			return &ih, nil
+			return &ih, sz, nil
 		}
 	}
 
 	for i := range ih.PanEnv {
 		if err := binary.Read(r, binary.LittleEndian, &ih.PanEnv[i].X); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz += 2; sz >= ih.Size {
-			return &ih, nil
+			return &ih, sz, nil
 		}
 		if err := binary.Read(r, binary.LittleEndian, &ih.PanEnv[i].Y); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz += 2; sz >= ih.Size {
-			return &ih, nil
+			return &ih, sz, nil
 		}
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VolPoints); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.PanPoints); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VolSustainPoint); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VolLoopStartPoint); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VolLoopEndPoint); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.PanSustainPoint); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.PanLoopStartPoint); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.PanLoopEndPoint); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VolFlags); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.PanFlags); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VibratoType); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VibratoSweep); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VibratoDepth); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VibratoRate); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ih.VolumeFadeout); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= ih.Size {
-		return &ih, nil
+		return &ih, sz, nil
 	}
 
 	for i := range ih.ReservedP241 {
 		if err := binary.Read(r, binary.LittleEndian, &ih.ReservedP241[i]); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz += 2; sz >= ih.Size {
-			return &ih, nil
+			return &ih, sz, nil
 		}
 	}
 
-	return &ih, nil
+	return &ih, sz, nil
 }
 
 func readInstrumentHeader(r io.Reader) (*InstrumentHeader, error) {
-	ih, err := readInstrumentHeaderPartial(r)
+	ih, sz, err := readInstrumentHeaderPartial(r)
 	if err != nil {
 		return nil, err
 	}
@@ -339,6 +436,13 @@ func readInstrumentHeader(r io.Reader) (*InstrumentHeader, error) {
 		return nil, errors.New("unusually small instrument header size - possibly corrupt file")
 	}
 
+	// anything beyond the understood fields is skipped (and kept)
+	if ih.Size > sz {
+		if ih.Extra, err = readExtra(r, ih.Size-sz); err != nil {
+			return nil, err
+		}
+	}
+
 	for i := uint16(0); i < ih.SamplesCount; i++ {
 		s := SampleHeader{}
 
@@ -382,24 +486,173 @@ func readInstrumentHeader(r io.Reader) (*InstrumentHeader, error) {
 			return nil, err
 		}
 
+		if ih.SampleHeaderSize > xmSampleHeaderSize {
+			if s.Extra, err = readExtra(r, ih.SampleHeaderSize-xmSampleHeaderSize); err != nil {
+				return nil, err
+			}
+		}
+
 		s.SampleData = make([]uint8, int(s.Length))
 
 		ih.Samples = append(ih.Samples, s)
 	}
 
-	for _, s := range ih.Samples {
+	return ih, nil
+}
+
+// readSampleData reads the sample data of every sample of the instrument `ih`
+func readSampleData(r io.Reader, ih *InstrumentHeader, keepPacked bool) error {
+	for i := range ih.Samples {
+		s := &ih.Samples[i]
+		if s.IsADPCM() {
+			packed := make([]uint8, util.ADPCM4PackedLength(int(s.Length)))
+			if _, err := io.ReadFull(r, packed); err != nil {
+				return err
+			}
+			s.SampleData = util.DecodeADPCM4(packed, int(s.Length))
+			if keepPacked {
+				s.PackedData = packed
+			}
+			continue
+		}
+
 		if err := binary.Read(r, binary.LittleEndian, &s.SampleData); err != nil {
-			return nil, err
+			return err
 		}
 
 		// convert the sample in the background
-		if (s.Flags & SampleFlag16Bit) != 0 {
-			convertSample16Bit(s.SampleData)
-		} else {
-			convertSample8Bit(s.SampleData)
+		// stereo samples are stored as the left channel followed by the right channel, each delta encoded on its own
+		for _, data := range sampleChannels(s.SampleData, s.Flags) {
+			if (s.Flags & SampleFlag16Bit) != 0 {
+				convertSample16Bit(data)
+			} else {
+				convertSample8Bit(data)
+			}
 		}
 	}
-	return ih, nil
+	return nil
+}
+
+// writeInstrumentHeader writes the instrument header, stopping at the same point the reader would (based on Size),
+// followed by any extra header bytes and the sample headers
+func writeInstrumentHeader(w io.Writer, ih *InstrumentHeader) error {
+	for _, v := range []interface{}{
+		&ih.Size,
+		&ih.Name,
+		&ih.Type,
+	} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	fields := []interface{}{
+		&ih.SamplesCount,
+		&ih.SampleHeaderSize,
+	}
+	for i := range ih.SampleNumber {
+		fields = append(fields, &ih.SampleNumber[i])
+	}
+	for i := range ih.VolEnv {
+		fields = append(fields, &ih.VolEnv[i].X, &ih.VolEnv[i].Y)
+	}
+	for i := range ih.PanEnv {
+		fields = append(fields, &ih.PanEnv[i].X, &ih.PanEnv[i].Y)
+	}
+	fields = append(fields,
+		&ih.VolPoints,
+		&ih.PanPoints,
+		&ih.VolSustainPoint,
+		&ih.VolLoopStartPoint,
+		&ih.VolLoopEndPoint,
+		&ih.PanSustainPoint,
+		&ih.PanLoopStartPoint,
+		&ih.PanLoopEndPoint,
+		&ih.VolFlags,
+		&ih.PanFlags,
+		&ih.VibratoType,
+		&ih.VibratoSweep,
+		&ih.VibratoDepth,
+		&ih.VibratoRate,
+		&ih.VolumeFadeout,
+	)
+	for i := range ih.ReservedP241 {
+		fields = append(fields, &ih.ReservedP241[i])
+	}
+
+	if err := writeFields(w, ih.Size, 4+22+1, fields); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(ih.Extra); err != nil {
+		return err
+	}
+
+	for i := range ih.Samples {
+		s := &ih.Samples[i]
+		for _, v := range []interface{}{
+			&s.Length,
+			&s.LoopStart,
+			&s.LoopLength,
+			&s.Volume,
+			&s.Finetune,
+			&s.Flags,
+			&s.Panning,
+			&s.RelativeNoteNumber,
+			&s.ReservedP17,
+			&s.Name,
+		} {
+			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(s.Extra); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSampleData writes the sample data of every sample of the instrument `ih`
+func writeSampleData(w io.Writer, ih *InstrumentHeader) error {
+	for _, s := range ih.Samples {
+		if s.IsADPCM() {
+			if _, err := w.Write(s.PackedData); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data := append([]uint8{}, s.SampleData...)
+		for _, c := range sampleChannels(data, s.Flags) {
+			if (s.Flags & SampleFlag16Bit) != 0 {
+				deltaSample16Bit(c)
+			} else {
+				deltaSample8Bit(c)
+			}
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sampleChannels splits sample data into the sections holding each channel
+// Stereo samples store the left channel followed by the right channel.
+func sampleChannels(data []uint8, flags SampleFlags) [][]uint8 {
+	if !flags.IsStereo() {
+		return [][]uint8{data}
+	}
+
+	half := len(data) / 2
+	if flags.Is16Bit() {
+		half &^= 1
+	}
+	return [][]uint8{data[:half], data[half : half*2]}
 }
 
 func convertSample8Bit(data []uint8) {
@@ -420,3 +673,23 @@ func convertSample16Bit(data []uint8) {
 		old = new
 	}
 }
+
+// deltaSample8Bit is the inverse of convertSample8Bit
+func deltaSample8Bit(data []uint8) {
+	old := int8(0)
+	for i, s := range data {
+		new := int8(s)
+		data[i] = uint8(new - old)
+		old = new
+	}
+}
+
+// deltaSample16Bit is the inverse of convertSample16Bit
+func deltaSample16Bit(data []uint8) {
+	old := int16(0)
+	for i := 0; i < len(data); i += 2 {
+		new := int16(binary.LittleEndian.Uint16(data[i:]))
+		binary.LittleEndian.PutUint16(data[i:], uint16(new-old))
+		old = new
+	}
+}
@@ -0,0 +1,25 @@
+package xm
+
+import "github.com/gotracker/goaudiofile/internal/util"
+
+// MessageBytes returns the song message as code page 437 text, with the line endings converted to LF
+// The message is stored in the "text" chunk with CR line endings.
+func (f *File) MessageBytes() []byte {
+	return util.MessageBytes(f.Message)
+}
+
+// MessageString returns the song message decoded into a (UTF-8) string, with the line endings converted to LF
+func (f *File) MessageString() string {
+	return util.DecodeCP437(f.MessageBytes())
+}
+
+// SetMessage replaces the song message with the (UTF-8) string `text`
+// The text is stored as code page 437, with CR line endings.
+func (f *File) SetMessage(text string) {
+	if text == "" {
+		f.Message = nil
+		return
+	}
+
+	f.Message = util.EncodeMessage(text)
+}
@@ -8,6 +8,19 @@ import (
 	"github.com/gotracker/goaudiofile/internal/util"
 )
 
+const (
+	// xmIDText is the identifier at the very start of every XM file
+	xmIDText = "Extended Module: "
+	// xmVersion is the file format version written by this package
+	xmVersion = 0x0104
+	// xmMaxChannels is the largest number of channels in a file (as written by OpenMPT)
+	xmMaxChannels = 127
+	// xmVersionPatternsFirst is the first file format version that stores the patterns before the instruments
+	xmVersionPatternsFirst = 0x0104
+	// xmHeaderSize is the size of the module header, starting at the HeaderSize field
+	xmHeaderSize = 276
+)
+
 // ModuleHeader is a representation of the XM file header
 type ModuleHeader struct {
 	IDText          [17]uint8
@@ -25,6 +38,8 @@ type ModuleHeader struct {
 	DefaultSpeed    uint16
 	DefaultTempo    uint16
 	OrderTable      [256]uint8
+
+	Extra []byte // bytes beyond the fields understood by the reader
 }
 
 // GetIDText returns a string representation of the data stored in the IDText field
@@ -42,6 +57,13 @@ func (mh *ModuleHeader) GetTrackerName() string {
 	return util.GetString(mh.Name[:])
 }
 
+// InstrumentsBeforePatterns returns true if the file stores the instruments before the patterns
+// Early FastTracker 2 versions (file format versions 0x0102 and 0x0103) store the instrument and sample headers
+// first, followed by the patterns and then the sample data of every instrument.
+func (mh *ModuleHeader) InstrumentsBeforePatterns() bool {
+	return mh.VersionNumber < xmVersionPatternsFirst
+}
+
 // HeaderFlags is the set of flags for an XM header
 type HeaderFlags uint16
 
@@ -62,110 +84,117 @@ func (f HeaderFlags) IsExtendedFilterRange() bool {
 	return (f & HeaderFlagExtendedFilterRange) != 0
 }
 
-func readHeaderPartial(r io.Reader) (*ModuleHeader, error) {
+func readHeaderPartial(r io.Reader) (*ModuleHeader, uint32, error) {
 	xmh := ModuleHeader{}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.IDText); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.Name); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.Reserved1A); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.TrackerName); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.VersionNumber); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	sz := uint32(0)
 	if err := binary.Read(r, binary.LittleEndian, &xmh.HeaderSize); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	sz += 4
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.SongLength); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.RestartPosition); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.NumChannels); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.NumPatterns); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.NumInstruments); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.Flags); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.DefaultSpeed); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &xmh.DefaultTempo); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= xmh.HeaderSize {
-		return &xmh, nil
+		return &xmh, sz, nil
 	}
 
 	for i := range xmh.OrderTable {
 		if err := binary.Read(r, binary.LittleEndian, &xmh.OrderTable[i]); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz++; sz >= xmh.HeaderSize {
-			return &xmh, nil
+			return &xmh, sz, nil
 		}
 	}
 
-	return &xmh, nil
+	return &xmh, sz, nil
 }
 
 func readHeader(r io.Reader) (*ModuleHeader, error) {
-	xmh, err := readHeaderPartial(r)
+	xmh, sz, err := readHeaderPartial(r)
 	if err != nil {
 		return nil, err
 	}
 
-	if xmh.NumChannels < 1 || xmh.NumChannels > 32 {
+	// anything beyond the understood fields is skipped (and kept)
+	if xmh.HeaderSize > sz {
+		if xmh.Extra, err = readExtra(r, xmh.HeaderSize-sz); err != nil {
+			return nil, err
+		}
+	}
+
+	if xmh.NumChannels < 1 || xmh.NumChannels > xmMaxChannels {
 		return nil, errors.New("invalid number of channels - possibly corrupt file")
 	}
 
@@ -179,3 +208,41 @@ func readHeader(r io.Reader) (*ModuleHeader, error) {
 
 	return xmh, nil
 }
+
+// writeHeader writes the module header, stopping at the same point the reader would (based on HeaderSize),
+// followed by any extra header bytes
+func writeHeader(w io.Writer, xmh *ModuleHeader) error {
+	for _, v := range []interface{}{
+		&xmh.IDText,
+		&xmh.Name,
+		&xmh.Reserved1A,
+		&xmh.TrackerName,
+		&xmh.VersionNumber,
+		&xmh.HeaderSize,
+	} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	fields := []interface{}{
+		&xmh.SongLength,
+		&xmh.RestartPosition,
+		&xmh.NumChannels,
+		&xmh.NumPatterns,
+		&xmh.NumInstruments,
+		&xmh.Flags,
+		&xmh.DefaultSpeed,
+		&xmh.DefaultTempo,
+	}
+	for i := range xmh.OrderTable {
+		fields = append(fields, &xmh.OrderTable[i])
+	}
+
+	if err := writeFields(w, xmh.HeaderSize, 4, fields); err != nil {
+		return err
+	}
+
+	_, err := w.Write(xmh.Extra)
+	return err
+}
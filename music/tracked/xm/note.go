@@ -0,0 +1,86 @@
+package xm
+
+import (
+	"fmt"
+
+	"github.com/gotracker/goaudiofile/music/tracked/s3m"
+)
+
+// Note is a note value of the pattern data
+// Notes 1 to 96 are C-0 to B-7, 97 is a key-off and 0 is no note at all.
+type Note uint8
+
+const (
+	// EmptyNote denotes an empty note
+	EmptyNote = Note(0)
+	// KeyOffNote denotes a key-off, which releases the instrument's envelopes
+	KeyOffNote = Note(97)
+
+	// notesPerOctave is the number of notes in each octave
+	notesPerOctave = 12
+)
+
+var keyNames = [notesPerOctave]string{"C-", "C#", "D-", "D#", "E-", "F-", "F#", "G-", "G#", "A-", "A#", "B-"}
+
+// NewNote returns the note for the key `key` in the octave `octave`
+func NewNote(key s3m.Key, octave s3m.Octave) Note {
+	return Note(uint8(octave)*notesPerOctave + uint8(key) + 1)
+}
+
+// IsEmpty returns true if there is no note
+func (n Note) IsEmpty() bool {
+	return n == EmptyNote
+}
+
+// IsKeyOff returns true if the note is a key-off
+func (n Note) IsKeyOff() bool {
+	return n == KeyOffNote
+}
+
+// IsInvalid returns true if the note is invalid in any way (or is empty or a key-off)
+func (n Note) IsInvalid() bool {
+	return n == EmptyNote || n >= KeyOffNote
+}
+
+// Key returns the key component of the note
+func (n Note) Key() s3m.Key {
+	if n.IsInvalid() {
+		return s3m.KeyInvalid1
+	}
+	return s3m.Key((n - 1) % notesPerOctave)
+}
+
+// Octave returns the octave component of the note
+func (n Note) Octave() s3m.Octave {
+	if n.IsInvalid() {
+		return 0
+	}
+	return s3m.Octave((n - 1) / notesPerOctave)
+}
+
+// Semitone returns the semitone value for the note, counting from C-0
+func (n Note) Semitone() s3m.Semitone {
+	if n.IsInvalid() {
+		return 0
+	}
+	return s3m.Semitone(n - 1)
+}
+
+// String returns the note the way trackers display it, such as "C#4"
+func (n Note) String() string {
+	switch {
+	case n.IsEmpty():
+		return "..."
+	case n.IsKeyOff():
+		return "==="
+	case n.IsInvalid():
+		return "???"
+	default:
+		return fmt.Sprintf("%s%d", keyNames[n.Key()], n.Octave())
+	}
+}
+
+// GetNote returns the note of the channel
+func (f ChannelData) GetNote() Note {
+	return Note(f.Note)
+}
@@ -0,0 +1,36 @@
+package xm
+
+import (
+	"testing"
+
+	"github.com/gotracker/goaudiofile/music/tracked/s3m"
+)
+
+func TestNote(t *testing.T) {
+	for _, tc := range []struct {
+		note     Note
+		str      string
+		key      s3m.Key
+		octave   s3m.Octave
+		semitone s3m.Semitone
+	}{
+		{EmptyNote, "...", s3m.KeyInvalid1, 0, 0},
+		{1, "C-0", s3m.KeyC, 0, 0},
+		{49, "C-4", s3m.KeyC, 4, 48},
+		{NewNote(s3m.KeyCSharp, 4), "C#4", s3m.KeyCSharp, 4, 49},
+		{96, "B-7", s3m.KeyB, 7, 95},
+		{KeyOffNote, "===", s3m.KeyInvalid1, 0, 0},
+		{98, "???", s3m.KeyInvalid1, 0, 0},
+	} {
+		if s := tc.note.String(); s != tc.str {
+			t.Errorf("note %d: unexpected string %q, expected %q", tc.note, s, tc.str)
+		}
+		if k, o, s := tc.note.Key(), tc.note.Octave(), tc.note.Semitone(); k != tc.key || o != tc.octave || s != tc.semitone {
+			t.Errorf("note %d: unexpected key %d, octave %d and semitone %d", tc.note, k, o, s)
+		}
+	}
+
+	if n := (ChannelData{Note: uint8(KeyOffNote)}).GetNote(); !n.IsKeyOff() || !n.IsInvalid() || n.IsEmpty() {
+		t.Errorf("note %d is not a key-off", n)
+	}
+}
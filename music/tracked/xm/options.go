@@ -0,0 +1,12 @@
+package xm
+
+import "github.com/gotracker/goaudiofile/internal/util"
+
+// ReadOption is an optional setting for Read
+type ReadOption = util.ReadOption
+
+// PreserveUnparsed makes Read keep the data following the last instrument in File.Unparsed and the surplus
+// bytes of the module, pattern, instrument and sample headers in their Extra fields
+func PreserveUnparsed() ReadOption {
+	return util.PreserveUnparsed()
+}
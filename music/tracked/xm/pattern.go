@@ -6,12 +6,19 @@ import (
 	"io"
 )
 
+const (
+	// xmPatternHeaderSize is the size of the pattern header, starting at the PatternHeaderLength field
+	xmPatternHeaderSize = 9
+)
+
 // PatternHeader is the XM packed pattern header definition
 type PatternHeader struct {
 	PatternHeaderLength   uint32
 	PackingType           uint8
 	NumRows               uint16
 	PackedPatternDataSize uint16
+
+	Extra []byte // bytes beyond the fields understood by the reader
 }
 
 // ChannelData is the XM unpacked pattern channel data definition
@@ -114,60 +121,67 @@ type PatternFileFormat struct {
 	PackedData []byte
 }
 
-func readPatternHeaderPartial(r io.Reader, fileVersion uint16) (*PatternHeader, error) {
+func readPatternHeaderPartial(r io.Reader, fileVersion uint16) (*PatternHeader, uint32, error) {
 	ph := PatternHeader{}
 
 	sz := uint32(0)
 	if err := binary.Read(r, binary.LittleEndian, &ph.PatternHeaderLength); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 4; sz >= ph.PatternHeaderLength {
-		return &ph, nil
+		return &ph, sz, nil
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ph.PackingType); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz++; sz >= ph.PatternHeaderLength {
-		return &ph, nil
+		return &ph, sz, nil
 	}
 
 	if fileVersion == 0x0102 {
 		var rowCount uint8
 		if err := binary.Read(r, binary.LittleEndian, &rowCount); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		ph.NumRows = uint16(rowCount) + 1
 		if sz++; sz >= ph.PatternHeaderLength {
-			return &ph, nil
+			return &ph, sz, nil
 		}
 
 	} else {
 		if err := binary.Read(r, binary.LittleEndian, &ph.NumRows); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if sz += 2; sz >= ph.PatternHeaderLength {
-			return &ph, nil
+			return &ph, sz, nil
 		}
 	}
 
 	if err := binary.Read(r, binary.LittleEndian, &ph.PackedPatternDataSize); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if sz += 2; sz >= ph.PatternHeaderLength {
-		return &ph, nil
+		return &ph, sz, nil
 	}
 
-	return &ph, nil
+	return &ph, sz, nil
 }
 
 func readPatternHeader(r io.Reader, fileVersion uint16) (*PatternHeader, error) {
-	ph, err := readPatternHeaderPartial(r, fileVersion)
+	ph, sz, err := readPatternHeaderPartial(r, fileVersion)
 	if err != nil {
 		return nil, err
 	}
 
+	// anything beyond the understood fields is skipped (and kept)
+	if ph.PatternHeaderLength > sz {
+		if ph.Extra, err = readExtra(r, ph.PatternHeaderLength-sz); err != nil {
+			return nil, err
+		}
+	}
+
 	//if ph.NumRows == 0 {
 	//	ph.NumRows = 64
 	//}
@@ -182,3 +196,26 @@ func readPatternHeader(r io.Reader, fileVersion uint16) (*PatternHeader, error)
 
 	return ph, nil
 }
+
+// writePatternHeader writes the pattern header, stopping at the same point the reader would (based on PatternHeaderLength),
+// followed by any extra header bytes
+func writePatternHeader(w io.Writer, ph *PatternHeader, fileVersion uint16) error {
+	fields := []interface{}{
+		&ph.PatternHeaderLength,
+		&ph.PackingType,
+	}
+	if fileVersion == 0x0102 {
+		rowCount := uint8(ph.NumRows - 1)
+		fields = append(fields, &rowCount)
+	} else {
+		fields = append(fields, &ph.NumRows)
+	}
+	fields = append(fields, &ph.PackedPatternDataSize)
+
+	if err := writeFields(w, ph.PatternHeaderLength, 0, fields); err != nil {
+		return err
+	}
+
+	_, err := w.Write(ph.Extra)
+	return err
+}
@@ -0,0 +1,38 @@
+package xm
+
+import (
+	"math"
+
+	"github.com/gotracker/goaudiofile/music/pcm"
+)
+
+// xmBaseFrequency is the playback rate of a sample with no finetune or relative note at middle C
+const xmBaseFrequency = 8363
+
+// PCM converts the sample data into a normalized sample
+func (sh *SampleHeader) PCM() *pcm.Sample {
+	channels := 1
+	if sh.Flags.IsStereo() {
+		channels = 2
+	}
+
+	var p *pcm.Sample
+	if sh.Flags.Is16Bit() {
+		p = pcm.FromSigned16LE(sh.InterleavedData(), channels)
+	} else {
+		p = pcm.FromSigned8(sh.InterleavedData(), channels)
+	}
+
+	// the finetune is in 1/128ths of a semitone
+	semitones := float64(sh.RelativeNoteNumber) + float64(sh.Finetune)/128
+	p.BaseFrequency = xmBaseFrequency * math.Pow(2, semitones/12)
+
+	if begin, end, ok := sh.Loop(); ok {
+		mode := pcm.LoopModeForward
+		if sh.Flags.LoopMode() == SampleLoopModePingPong {
+			mode = pcm.LoopModePingPong
+		}
+		p.Loop = pcm.NewLoop(mode, int(begin), int(end), p.Frames())
+	}
+	return p
+}
@@ -0,0 +1,90 @@
+package xm
+
+// VolumeCommand is a command of the volume column
+type VolumeCommand uint8
+
+const (
+	// VolumeCommandNone is an empty volume column (0x00-0x0F, or the unused 0x51-0x5F)
+	VolumeCommandNone = VolumeCommand(iota)
+	// VolumeCommandSetVolume sets the volume to the value (0-64)
+	VolumeCommandSetVolume
+	// VolumeCommandSlideDown slides the volume down by the value on every tick but the first
+	VolumeCommandSlideDown
+	// VolumeCommandSlideUp slides the volume up by the value on every tick but the first
+	VolumeCommandSlideUp
+	// VolumeCommandFineSlideDown slides the volume down by the value once
+	VolumeCommandFineSlideDown
+	// VolumeCommandFineSlideUp slides the volume up by the value once
+	VolumeCommandFineSlideUp
+	// VolumeCommandVibratoSpeed sets the vibrato speed
+	VolumeCommandVibratoSpeed
+	// VolumeCommandVibrato performs a vibrato with the value as its depth
+	VolumeCommandVibrato
+	// VolumeCommandSetPanning sets the (coarse) panning position
+	VolumeCommandSetPanning
+	// VolumeCommandPanSlideLeft slides the panning to the left
+	VolumeCommandPanSlideLeft
+	// VolumeCommandPanSlideRight slides the panning to the right
+	VolumeCommandPanSlideRight
+	// VolumeCommandTonePortamento performs a tone portamento with the value as its speed
+	VolumeCommandTonePortamento
+)
+
+const (
+	// volumeSetMin is the first byte of the set volume command
+	volumeSetMin = 0x10
+	// volumeSetMax is the last byte of the set volume command
+	volumeSetMax = 0x50
+	// volumeCommandsMin is the first byte of the commands that hold their value in the low nibble
+	volumeCommandsMin = 0x60
+)
+
+// VolumeColumn is a decoded volume column value
+type VolumeColumn struct {
+	Command VolumeCommand
+	Value   uint8
+}
+
+// DecodeVolume decodes the volume column byte `v`
+func DecodeVolume(v uint8) VolumeColumn {
+	switch {
+	case v >= volumeSetMin && v <= volumeSetMax:
+		return VolumeColumn{
+			Command: VolumeCommandSetVolume,
+			Value:   v - volumeSetMin,
+		}
+	case v >= volumeCommandsMin:
+		return VolumeColumn{
+			Command: VolumeCommandSlideDown + VolumeCommand((v-volumeCommandsMin)>>4),
+			Value:   v & 0x0F,
+		}
+	default:
+		return VolumeColumn{}
+	}
+}
+
+// Encode returns the volume column byte for the command
+// Values that are out of range for the command are clamped.
+func (v VolumeColumn) Encode() uint8 {
+	switch {
+	case v.Command == VolumeCommandSetVolume:
+		value := v.Value
+		if value > volumeSetMax-volumeSetMin {
+			value = volumeSetMax - volumeSetMin
+		}
+		return volumeSetMin + value
+	case v.Command >= VolumeCommandSlideDown && v.Command <= VolumeCommandTonePortamento:
+		value := v.Value
+		if value > 0x0F {
+			value = 0x0F
+		}
+		return volumeCommandsMin + uint8(v.Command-VolumeCommandSlideDown)<<4 + value
+	default:
+		return 0
+	}
+}
+
+// GetVolume returns the decoded volume column of the channel
+func (f ChannelData) GetVolume() VolumeColumn {
+	return DecodeVolume(f.Volume)
+}
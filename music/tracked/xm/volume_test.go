@@ -0,0 +1,49 @@
+package xm
+
+import "testing"
+
+func TestDecodeVolume(t *testing.T) {
+	for _, tc := range []struct {
+		v        uint8
+		expected VolumeColumn
+	}{
+		{0x00, VolumeColumn{}},
+		{0x0F, VolumeColumn{}},
+		{0x10, VolumeColumn{VolumeCommandSetVolume, 0}},
+		{0x50, VolumeColumn{VolumeCommandSetVolume, 64}},
+		{0x51, VolumeColumn{}},
+		{0x5F, VolumeColumn{}},
+		{0x63, VolumeColumn{VolumeCommandSlideDown, 3}},
+		{0x7F, VolumeColumn{VolumeCommandSlideUp, 15}},
+		{0x81, VolumeColumn{VolumeCommandFineSlideDown, 1}},
+		{0x92, VolumeColumn{VolumeCommandFineSlideUp, 2}},
+		{0xA4, VolumeColumn{VolumeCommandVibratoSpeed, 4}},
+		{0xB5, VolumeColumn{VolumeCommandVibrato, 5}},
+		{0xC8, VolumeColumn{VolumeCommandSetPanning, 8}},
+		{0xD1, VolumeColumn{VolumeCommandPanSlideLeft, 1}},
+		{0xE1, VolumeColumn{VolumeCommandPanSlideRight, 1}},
+		{0xFF, VolumeColumn{VolumeCommandTonePortamento, 15}},
+	} {
+		vc := (ChannelData{Volume: tc.v}).GetVolume()
+		if vc != tc.expected {
+			t.Errorf("%#02x: unexpected volume column %+v, expected %+v", tc.v, vc, tc.expected)
+		}
+		if vc.Command != VolumeCommandNone {
+			if v := vc.Encode(); v != tc.v {
+				t.Errorf("%#02x: encoded as %#02x", tc.v, v)
+			}
+		}
+	}
+}
+
+func TestEncodeVolumeClamped(t *testing.T) {
+	if v := (VolumeColumn{VolumeCommandSetVolume, 100}).Encode(); v != 0x50 {
+		t.Errorf("unexpected set volume %#02x", v)
+	}
+	if v := (VolumeColumn{VolumeCommandVibrato, 0x20}).Encode(); v != 0xBF {
+		t.Errorf("unexpected vibrato %#02x", v)
+	}
+	if v := (VolumeColumn{}).Encode(); v != 0 {
+		t.Errorf("unexpected empty volume column %#02x", v)
+	}
+}
@@ -3,7 +3,12 @@ package xm
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+
+	"github.com/gotracker/goaudiofile/internal/util"
+	"github.com/gotracker/goaudiofile/music/tracked/it/block"
 )
 
 // File is an XM internal file representation
@@ -11,10 +16,29 @@ type File struct {
 	Head        ModuleHeader
 	Patterns    []Pattern
 	Instruments []InstrumentHeader
+	Message     []byte            // the song message, exactly as stored in the file (see MessageBytes and MessageString)
+	MIDIConfig  *block.MIDIConfig // only set when the file has a MIDI configuration
+	Blocks      []block.Block     // the PNAM, CNAM, CHFX and FX blocks that OpenMPT writes after the sample data
+	Extensions  []block.Block     // the XTPM and STPM blocks that follow them
+	// KeepLayout makes Write keep the identifier, version and header sizes from Head, Patterns and
+	// Instruments, along with their Extra bytes, the packed data of unmodified patterns and the
+	// original lengths of the pattern and channel name blocks
+	// Read sets it when the PreserveUnparsed option is used
+	KeepLayout bool
+	Unparsed   *Unparsed
+}
+
+// Unparsed holds the parts of the file that the reader does not interpret
+// It is only filled in when reading with the PreserveUnparsed option, which also sets File.KeepLayout
+// so that Write keeps the Extra bytes of the module, pattern, instrument and sample headers
+type Unparsed struct {
+	Trailing []byte // everything after the last instrument (and the chunks that OpenMPT writes after it)
 }
 
 // Read reads an XM file from the reader `r` and creates an internal File representation
-func Read(r io.Reader) (*File, error) {
+func Read(r io.Reader, opts ...ReadOption) (*File, error) {
+	o := util.GetReadOptions(opts)
+
 	xmh, err := readHeader(r)
 	if err != nil {
 		return nil, err
@@ -24,40 +48,230 @@ func Read(r io.Reader) (*File, error) {
 		Head: *xmh,
 	}
 
-	for i := uint16(0); i < xmh.NumPatterns; i++ {
+	if xmh.InstrumentsBeforePatterns() {
+		// the instrument headers come first, and the sample data of all of them follows the patterns
+		if err := f.readInstruments(r, false, o.PreserveUnparsed); err != nil {
+			return nil, err
+		}
+		if err := f.readPatterns(r); err != nil {
+			return nil, err
+		}
+		for i := range f.Instruments {
+			if err := readSampleData(r, &f.Instruments[i], o.PreserveUnparsed); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if err := f.readPatterns(r); err != nil {
+			return nil, err
+		}
+		if err := f.readInstruments(r, true, o.PreserveUnparsed); err != nil {
+			return nil, err
+		}
+	}
+
+	trailing, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := f.readChunks(trailing)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.PreserveUnparsed {
+		f.KeepLayout = true
+		f.Unparsed = &Unparsed{
+			Trailing: trailing[n:],
+		}
+	}
+
+	return &f, nil
+}
+
+// readPatterns reads the pattern headers and their packed data
+func (f *File) readPatterns(r io.Reader) error {
+	for i := uint16(0); i < f.Head.NumPatterns; i++ {
 		p := Pattern{}
 
-		ph, err := readPatternHeader(r, xmh.VersionNumber)
+		ph, err := readPatternHeader(r, f.Head.VersionNumber)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		p.Header = *ph
 
 		ppd := make([]byte, int(ph.PackedPatternDataSize))
 		if err := binary.Read(r, binary.LittleEndian, &ppd); err != nil {
-			return nil, err
+			return err
 		}
 
 		p.PackedData = ppd
 
-		if err := p.unpack(int(xmh.NumChannels)); err != nil {
-			return nil, err
+		if err := p.unpack(int(f.Head.NumChannels)); err != nil {
+			return err
 		}
 
 		f.Patterns = append(f.Patterns, p)
 	}
+	return nil
+}
 
-	for i := uint16(0); i < xmh.NumInstruments; i++ {
+// readInstruments reads the instrument headers and, if `withSampleData` is set, the sample data following each of them
+func (f *File) readInstruments(r io.Reader, withSampleData bool, keepPacked bool) error {
+	for i := uint16(0); i < f.Head.NumInstruments; i++ {
 		ih, err := readInstrumentHeader(r)
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		if withSampleData {
+			if err := readSampleData(r, ih, keepPacked); err != nil {
+				return err
+			}
 		}
 
 		f.Instruments = append(f.Instruments, *ih)
 	}
+	return nil
+}
+
+// Write writes the internal XM File representation `f` to the writer `w`
+// Counts are always recalculated from the contents of `f`. Unless `f.KeepLayout` is set, so are the
+// header sizes and the packed pattern data, and the result is a version 0x0104 file: this drops the
+// Extra header bytes and rewrites files of older versions in the 0x0104 layout
+// The song message, MIDI configuration and blocks are written after the last instrument, as OpenMPT does,
+// followed by the data in `f.Unparsed` when it is present
+func Write(w io.Writer, f *File) error {
+	if f == nil {
+		return errors.New("f is nil")
+	}
+
+	preserve := f.KeepLayout
+
+	xmh := f.Head
+	if !preserve {
+		copy(xmh.IDText[:], xmIDText)
+		xmh.Reserved1A = 0x1A
+		xmh.VersionNumber = xmVersion
+		xmh.HeaderSize = xmHeaderSize
+		xmh.Extra = nil
+	}
+	xmh.NumPatterns = uint16(len(f.Patterns))
+	xmh.NumInstruments = uint16(len(f.Instruments))
+
+	out := &bytes.Buffer{}
+	if err := writeHeader(out, &xmh); err != nil {
+		return err
+	}
+
+	patterns := &bytes.Buffer{}
+
+	for i := range f.Patterns {
+		p := &f.Patterns[i]
+		if len(p.Data) < 1 || len(p.Data) > 256 {
+			return fmt.Errorf("pattern %d row count out of range", i)
+		}
+
+		packed, err := p.pack(int(xmh.NumChannels))
+		if err != nil {
+			return err
+		}
+		if preserve && p.isPackedDataCurrent(int(xmh.NumChannels)) {
+			// other trackers pack differently, so keep their encoding when nothing has changed
+			packed = p.PackedData
+		}
+		if len(packed) > 0xFFFF {
+			return fmt.Errorf("pattern %d packed data is too large", i)
+		}
+
+		ph := p.Header
+		if !preserve {
+			ph.PatternHeaderLength = xmPatternHeaderSize
+			ph.Extra = nil
+		}
+		ph.PackingType = 0
+		ph.NumRows = uint16(len(p.Data))
+		ph.PackedPatternDataSize = uint16(len(packed))
+		if err := writePatternHeader(patterns, &ph, xmh.VersionNumber); err != nil {
+			return err
+		}
+		patterns.Write(packed)
+	}
+
+	instruments := &bytes.Buffer{}
+	sampleData := &bytes.Buffer{}
+	for i := range f.Instruments {
+		ih := f.Instruments[i]
+		ih.SamplesCount = uint16(len(ih.Samples))
+		if !preserve {
+			ih.Size = xmInstrumentHeaderShortSize
+			if ih.SamplesCount > 0 {
+				ih.Size = xmInstrumentHeaderSize
+				ih.SampleHeaderSize = xmSampleHeaderSize
+			}
+			ih.Extra = nil
+		}
+
+		ih.Samples = append([]SampleHeader{}, ih.Samples...)
+		for j := range ih.Samples {
+			s := &ih.Samples[j]
+			if !preserve {
+				s.Extra = nil
+			} else if len(s.Extra) != int(ih.SampleHeaderSize)-xmSampleHeaderSize && ih.SampleHeaderSize > xmSampleHeaderSize {
+				return fmt.Errorf("instrument %d sample %d extra header data does not match the sample header size", i+1, j)
+			}
+			if len(s.SampleData)%s.FrameSize() != 0 {
+				return fmt.Errorf("instrument %d sample %d has a partial sample frame", i+1, j)
+			}
+			if s.IsADPCM() && (!preserve || !s.isPackedDataCurrent()) {
+				// the sample data can't be packed again, so it's written unpacked
+				s.ReservedP17 = 0
+				s.PackedData = nil
+			}
+			s.Length = uint32(len(s.SampleData))
+		}
+
+		if err := writeInstrumentHeader(instruments, &ih); err != nil {
+			return err
+		}
+
+		samples := instruments
+		if xmh.InstrumentsBeforePatterns() {
+			samples = sampleData
+		}
+		if err := writeSampleData(samples, &ih); err != nil {
+			return err
+		}
+	}
+
+	if xmh.InstrumentsBeforePatterns() {
+		// the instrument headers come first, and the sample data of all of them follows the patterns
+		out.Write(instruments.Bytes())
+		out.Write(patterns.Bytes())
+		out.Write(sampleData.Bytes())
+	} else {
+		out.Write(patterns.Bytes())
+		out.Write(instruments.Bytes())
+	}
+
+	if err := writeChunks(out, f, preserve); err != nil {
+		return err
+	}
 
-	return &f, err
+	if f.Unparsed != nil {
+		out.Write(f.Unparsed.Trailing)
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// isPackedDataCurrent returns true when the ADPCM packed data still decodes to the sample data
+func (sh *SampleHeader) isPackedDataCurrent() bool {
+	frames := len(sh.SampleData)
+	return len(sh.PackedData) == util.ADPCM4PackedLength(frames) && bytes.Equal(util.DecodeADPCM4(sh.PackedData, frames), sh.SampleData)
 }
 
 // Pattern is an XM internal file representation and converted/unpacked pattern set
@@ -139,3 +353,113 @@ func (p *Pattern) unpack(numChannels int) error {
 
 	return nil
 }
+
+// isPackedDataCurrent returns true when the packed data still unpacks to the pattern's current contents
+func (p *Pattern) isPackedDataCurrent(numChannels int) bool {
+	if len(p.PackedData) == 0 {
+		return false
+	}
+
+	orig := Pattern{
+		PatternFileFormat: p.PatternFileFormat,
+	}
+	orig.Header.NumRows = uint16(len(p.Data))
+	if err := orig.unpack(numChannels); err != nil {
+		return false
+	}
+
+	for i, row := range orig.Data {
+		if len(row) != len(p.Data[i]) {
+			return false
+		}
+		for c, ch := range row {
+			if ch != p.Data[i][c] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pack compresses the pattern data into the XM packed format, using the shortest encoding for each channel
+// Zero values are left out, as they are indistinguishable from missing values once unpacked
+func (p *Pattern) pack(numChannels int) ([]byte, error) {
+	packed := &bytes.Buffer{}
+	empty := true
+	for i, row := range p.Data {
+		if len(row) != numChannels {
+			return nil, fmt.Errorf("unexpected number of channels in row %d", i)
+		}
+		for _, ch := range row {
+			flags := ChannelFlagValid
+			var values []uint8
+			if ch.Note != 0 {
+				flags |= ChannelFlagHasNote
+				values = append(values, ch.Note)
+			}
+			if ch.Instrument != 0 {
+				flags |= ChannelFlagHasInstrument
+				values = append(values, ch.Instrument)
+			}
+			if ch.Volume != 0 {
+				flags |= ChannelFlagHasVolume
+				values = append(values, ch.Volume)
+			}
+			if ch.Effect != 0 {
+				flags |= ChannelFlagHasEffect
+				values = append(values, ch.Effect)
+			}
+			if ch.EffectParameter != 0 {
+				flags |= ChannelFlagHasEffectParameter
+				values = append(values, ch.EffectParameter)
+			}
+
+			if len(values) > 0 {
+				empty = false
+			}
+
+			if len(values) == 5 && !ChannelFlags(ch.Note).IsValid() {
+				// everything is present, so the raw note form is a byte shorter
+				packed.Write(values)
+				continue
+			}
+
+			packed.WriteByte(uint8(flags))
+			packed.Write(values)
+		}
+	}
+
+	if empty {
+		// a completely empty pattern doesn't need any data
+		return nil, nil
+	}
+
+	return packed.Bytes(), nil
+}
+
+// readExtra reads `n` bytes of header data that the reader does not understand
+func readExtra(r io.Reader, n uint32) ([]byte, error) {
+	// the size comes from the file, so don't trust it until the data has actually been read
+	extra, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if len(extra) != int(n) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return extra, nil
+}
+
+// writeFields writes `fields` in order, adding their sizes to `sz` and stopping as soon as
+// `sz` reaches `size` - this mirrors how the partial header readers stop reading
+func writeFields(w io.Writer, size uint32, sz uint32, fields []interface{}) error {
+	for _, v := range fields {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+		if sz += uint32(binary.Size(v)); sz >= size {
+			break
+		}
+	}
+	return nil
+}
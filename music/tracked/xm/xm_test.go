@@ -0,0 +1,372 @@
+package xm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/gotracker/goaudiofile/internal/testutil"
+	"github.com/gotracker/goaudiofile/music/tracked/it/block"
+)
+
+// testSampleData is the (delta encoded) sample data of the test instrument
+var testSampleData = []byte{0x10, 0x10, 0xE0, 0x00}
+
+// testPatternData is the packed data of the test pattern: two rows of two channels,
+// with a C-4 of instrument 1 on the first channel of the first row
+var testPatternData = []byte{0x83, 49, 1, 0x80, 0x80, 0x80}
+
+func writeLE(b *bytes.Buffer, values ...interface{}) {
+	for _, v := range values {
+		if err := binary.Write(b, binary.LittleEndian, v); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func writeTestModuleHeader(b *bytes.Buffer, version uint16) {
+	var name, tracker [20]byte
+	copy(name[:], "test song")
+	copy(tracker[:], "FastTracker v2.00")
+	var orders [256]uint8
+
+	b.WriteString(xmIDText)
+	writeLE(b, name, uint8(0x1A), tracker, version, uint32(xmHeaderSize))
+	// song length, restart position, channels, patterns, instruments, flags, speed, tempo
+	writeLE(b, uint16(1), uint16(0), uint16(2), uint16(1), uint16(1), uint16(1), uint16(6), uint16(125))
+	writeLE(b, orders)
+}
+
+func writeTestPattern(b *bytes.Buffer, version uint16) {
+	if version == 0x0102 {
+		// the row count is a single byte, holding the number of rows minus 1
+		writeLE(b, uint32(8), uint8(0), uint8(2-1), uint16(len(testPatternData)))
+	} else {
+		writeLE(b, uint32(xmPatternHeaderSize), uint8(0), uint16(2), uint16(len(testPatternData)))
+	}
+	b.Write(testPatternData)
+}
+
+func writeTestInstrumentHeader(b *bytes.Buffer) {
+	var name [22]byte
+	copy(name[:], "test instrument")
+	var sampleNumber [96]uint8
+	var envelopes [2][12]EnvPoint
+	// points, sustain/loop points, flags and vibrato
+	var params [14]uint8
+	var reserved [11]uint16
+
+	writeLE(b, uint32(xmInstrumentHeaderSize), name, uint8(0), uint16(1))
+	writeLE(b, uint32(xmSampleHeaderSize), sampleNumber, envelopes, params, uint16(0x100), reserved)
+
+	var sampleName [22]byte
+	copy(sampleName[:], "test sample")
+	// length, loop start, loop length, volume, finetune, flags, panning, relative note, reserved, name
+	writeLE(b, uint32(len(testSampleData)), uint32(0), uint32(0), uint8(64), int8(0), uint8(0), uint8(0x80), int8(0), uint8(0), sampleName)
+}
+
+func readPreserved(r io.Reader) (*File, error) {
+	return Read(r, PreserveUnparsed())
+}
+
+func TestPreserveUnparsedRoundTrip(t *testing.T) {
+	b := &bytes.Buffer{}
+	writeTestModuleHeader(b, xmVersion)
+	writeTestPattern(b, xmVersion)
+	writeTestInstrumentHeader(b)
+	b.Write(testSampleData)
+	b.WriteString("trailing data")
+
+	f := testutil.RoundTrip(t, b.Bytes(), readPreserved, Write)
+
+	if !f.KeepLayout {
+		t.Error("expected the layout to be kept")
+	}
+	if len(f.Patterns) != 1 || len(f.Instruments) != 1 {
+		t.Fatalf("unexpected file contents")
+	}
+	if string(f.Unparsed.Trailing) != "trailing data" {
+		t.Errorf("unexpected trailing data %q", f.Unparsed.Trailing)
+	}
+}
+
+func TestWriteStandardLayout(t *testing.T) {
+	b := &bytes.Buffer{}
+	writeTestModuleHeader(b, xmVersion)
+	writeTestPattern(b, xmVersion)
+	writeTestInstrumentHeader(b)
+	b.Write(testSampleData)
+	data := b.Bytes()
+
+	f, err := readPreserved(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an older version and surplus module header bytes are only written when the layout is kept
+	f.Head.VersionNumber = 0x0103
+	f.Head.HeaderSize += 2
+	f.Head.Extra = []byte{1, 2}
+	f.KeepLayout = false
+
+	out := &bytes.Buffer{}
+	if err := Write(out, f); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("written file is not a standard version 0x0104 file")
+	}
+}
+
+// buildADPCMTestFile builds a file with a single ADPCM packed sample of 4 frames
+func buildADPCMTestFile() []byte {
+	// a delta table, followed by the nibbles 1, 2, 15 and 9
+	packed := []byte{
+		0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40,
+		0xFF, 0xFE, 0xFC, 0xF8, 0xF0, 0xE0, 0xD0, 0xC0,
+		0x21, 0x9F,
+	}
+
+	b := &bytes.Buffer{}
+	writeTestModuleHeader(b, xmVersion)
+	writeTestPattern(b, xmVersion)
+	writeTestInstrumentHeader(b)
+	b.Write(packed)
+	data := b.Bytes()
+
+	// turn the sample header into the one of a packed sample of 4 frames
+	hdr := bytes.Index(data, []byte("test sample")) - 18
+	binary.LittleEndian.PutUint32(data[hdr:], 4)
+	data[hdr+17] = sampleADPCMMarker
+	return data
+}
+
+func TestPreserveADPCMSample(t *testing.T) {
+	f := testutil.RoundTrip(t, buildADPCMTestFile(), readPreserved, Write)
+
+	s := &f.Instruments[0].Samples[0]
+	if !s.IsADPCM() {
+		t.Error("expected an ADPCM packed sample")
+	}
+	if !bytes.Equal(s.SampleData, []byte{0x01, 0x03, 0xC3, 0xC1}) {
+		t.Errorf("unexpected sample data % x", s.SampleData)
+	}
+
+	// once the sample data changes, it's written unpacked
+	s.SampleData[0] = 0
+	out := &bytes.Buffer{}
+	if err := Write(out, f); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Read(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := &g.Instruments[0].Samples[0]; s.IsADPCM() || !bytes.Equal(s.SampleData, []byte{0x00, 0x03, 0xC3, 0xC1}) {
+		t.Errorf("unexpected sample data % x", s.SampleData)
+	}
+}
+
+func TestStereoSample(t *testing.T) {
+	b := &bytes.Buffer{}
+	writeTestModuleHeader(b, xmVersion)
+	writeTestPattern(b, xmVersion)
+	writeTestInstrumentHeader(b)
+	b.Write(testSampleData)
+	data := b.Bytes()
+
+	// turn the sample into a looped 8-bit stereo sample of 2 frames, with the loop starting at the second one
+	hdr := bytes.Index(data, []byte("test sample")) - 18
+	binary.LittleEndian.PutUint32(data[hdr+4:], 2)
+	binary.LittleEndian.PutUint32(data[hdr+8:], 2)
+	data[hdr+14] = uint8(SampleFlagStereo) | uint8(SampleLoopModeEnabled)
+
+	f := testutil.RoundTrip(t, data, readPreserved, Write)
+
+	s := &f.Instruments[0].Samples[0]
+	if n := s.Frames(); n != 2 {
+		t.Errorf("unexpected number of frames %d", n)
+	}
+	if n := s.LoopStartFrame(); n != 1 {
+		t.Errorf("unexpected loop start %d", n)
+	}
+	if begin, end, ok := s.Loop(); !ok || begin != 1 || end != 2 {
+		t.Errorf("unexpected loop %d-%d (%v)", begin, end, ok)
+	}
+
+	// each channel is delta encoded on its own
+	if !bytes.Equal(s.SampleData, []byte{0x10, 0x20, 0xE0, 0xE0}) {
+		t.Errorf("unexpected sample data % x", s.SampleData)
+	}
+	if d := s.InterleavedData(); !bytes.Equal(d, []byte{0x10, 0xE0, 0x20, 0xE0}) {
+		t.Errorf("unexpected interleaved sample data % x", d)
+	}
+
+	s.SetInterleavedData([]byte{0x01, 0x02, 0x03, 0x04})
+	if !bytes.Equal(s.SampleData, []byte{0x01, 0x03, 0x02, 0x04}) {
+		t.Errorf("unexpected sample data % x after setting interleaved data", s.SampleData)
+	}
+}
+
+func TestStereo16BitFrames(t *testing.T) {
+	s := &SampleHeader{
+		Flags:      SampleFlag16Bit | SampleFlagStereo,
+		Length:     8,
+		LoopStart:  4,
+		LoopLength: 4,
+		// left 0x0201 0x0403, right 0x0605 0x0807
+		SampleData: []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+	}
+	if n := s.Frames(); n != 2 {
+		t.Errorf("unexpected number of frames %d", n)
+	}
+	if n := s.LoopStartFrame(); n != 1 {
+		t.Errorf("unexpected loop start %d", n)
+	}
+	if d := s.InterleavedData(); !bytes.Equal(d, []byte{0x01, 0x02, 0x05, 0x06, 0x03, 0x04, 0x07, 0x08}) {
+		t.Errorf("unexpected interleaved sample data % x", d)
+	}
+}
+
+// buildInstrumentsFirstFile builds a version 0x0102 or 0x0103 file, which stores the instrument headers
+// before the patterns and the sample data after them
+func buildInstrumentsFirstFile(version uint16) []byte {
+	b := &bytes.Buffer{}
+	writeTestModuleHeader(b, version)
+	writeTestInstrumentHeader(b)
+	writeTestPattern(b, version)
+	b.Write(testSampleData)
+	return b.Bytes()
+}
+
+func TestInstrumentsBeforePatterns(t *testing.T) {
+	b := &bytes.Buffer{}
+	writeTestModuleHeader(b, xmVersion)
+	writeTestPattern(b, xmVersion)
+	writeTestInstrumentHeader(b)
+	b.Write(testSampleData)
+	standard := b.Bytes()
+
+	for _, version := range []uint16{0x0102, 0x0103} {
+		f := testutil.RoundTrip(t, buildInstrumentsFirstFile(version), readPreserved, Write)
+
+		if !f.Head.InstrumentsBeforePatterns() {
+			t.Errorf("version %#04x: expected the instruments before the patterns", version)
+		}
+		if len(f.Patterns) != 1 || len(f.Patterns[0].Data) != 2 {
+			t.Fatalf("version %#04x: unexpected patterns", version)
+		}
+		if ch := f.Patterns[0].Data[0][0]; ch.Note != 49 || ch.Instrument != 1 {
+			t.Errorf("version %#04x: unexpected channel data %+v", version, ch)
+		}
+		if len(f.Instruments) != 1 || len(f.Instruments[0].Samples) != 1 {
+			t.Fatalf("version %#04x: unexpected instruments", version)
+		}
+		if s := f.Instruments[0].Samples[0].SampleData; !bytes.Equal(s, []byte{0x10, 0x20, 0x00, 0x00}) {
+			t.Errorf("version %#04x: unexpected sample data % x", version, s)
+		}
+		if len(f.Unparsed.Trailing) != 0 {
+			t.Errorf("version %#04x: unexpected trailing data % x", version, f.Unparsed.Trailing)
+		}
+
+		// without keeping the layout, the file is rewritten in the version 0x0104 layout
+		f.KeepLayout = false
+		out := &bytes.Buffer{}
+		if err := Write(out, f); err != nil {
+			t.Fatalf("version %#04x: %v", version, err)
+		}
+		if !bytes.Equal(out.Bytes(), standard) {
+			t.Errorf("version %#04x: written file is not a standard version 0x0104 file", version)
+		}
+	}
+}
+
+func TestSkipSurplusHeaderBytes(t *testing.T) {
+	b := &bytes.Buffer{}
+	writeTestModuleHeader(b, xmVersion)
+	writeTestPattern(b, xmVersion)
+	writeTestInstrumentHeader(b)
+	b.Write(testSampleData)
+	data := b.Bytes()
+
+	// grow the module header by 4 bytes, which a newer tracker might have added
+	const headerSizeOffset = 60
+	binary.LittleEndian.PutUint32(data[headerSizeOffset:], xmHeaderSize+4)
+	end := headerSizeOffset + xmHeaderSize
+	data = append(data[:end:end], append([]byte{1, 2, 3, 4}, data[end:]...)...)
+
+	// the surplus bytes are skipped and kept, even without the PreserveUnparsed option
+	f, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.Head.Extra, []byte{1, 2, 3, 4}) {
+		t.Errorf("unexpected extra module header data % x", f.Head.Extra)
+	}
+	if len(f.Patterns) != 1 || len(f.Instruments) != 1 {
+		t.Fatalf("unexpected file contents")
+	}
+	if ch := f.Patterns[0].Data[0][0]; ch.Note != 49 || ch.Instrument != 1 {
+		t.Errorf("unexpected channel data %+v", ch)
+	}
+}
+
+// writeTestChunk writes a chunk as OpenMPT writes them after the sample data
+func writeTestChunk(b *bytes.Buffer, id string, body []byte) {
+	b.WriteString(id)
+	writeLE(b, uint32(len(body)))
+	b.Write(body)
+}
+
+func TestPreserveADPCMSampleAndChunks(t *testing.T) {
+	b := bytes.NewBuffer(buildADPCMTestFile())
+	writeTestChunk(b, "text", []byte("hello\rworld"))
+	midi := make([]byte, block.MIDIConfigSize)
+	copy(midi, "FF")
+	writeTestChunk(b, "MIDI", midi)
+	// the last pattern name is cut short
+	pnam := make([]byte, 32+8)
+	copy(pnam, "intro")
+	copy(pnam[32:], "verse")
+	writeTestChunk(b, "PNAM", pnam)
+	cnam := make([]byte, 2*20)
+	copy(cnam[20:], "bass")
+	writeTestChunk(b, "CNAM", cnam)
+	// a plugin with 4 bytes of data
+	fx := make([]byte, 4+4+1+1+1+1+4+16+32+64)
+	copy(fx, "OMXD")
+	copy(fx[4+4+1+1+1+1+4+16+32:], "Echo")
+	writeTestChunk(b, "FX00", append(binary.LittleEndian.AppendUint32(fx, 4), 1, 2, 3, 4))
+	// instrument 1 is routed to plugin 1, in modern tempo mode
+	b.WriteString("XTPM" + ".PiM\x01\x00" + "\x01")
+	b.WriteString("STPM" + "..MT\x01\x00" + "\x02")
+	b.WriteString("trailing data")
+
+	f := testutil.RoundTrip(t, b.Bytes(), readPreserved, Write)
+
+	if s := &f.Instruments[0].Samples[0]; !s.IsADPCM() || !bytes.Equal(s.SampleData, []byte{0x01, 0x03, 0xC3, 0xC1}) {
+		t.Errorf("unexpected sample data % x", s.SampleData)
+	}
+	if msg := f.MessageString(); msg != "hello\nworld" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if f.MIDIConfig == nil || f.MIDIConfig.Global[block.MIDIGlobalStart].String() != "FF" {
+		t.Error("unexpected MIDI configuration")
+	}
+	if len(f.Blocks) != 3 || len(f.Extensions) != 2 {
+		t.Fatalf("unexpected number of blocks %d and extensions %d", len(f.Blocks), len(f.Extensions))
+	}
+	if pn, ok := f.Blocks[0].(*block.PatternNames); !ok || len(pn.Name) != 2 || pn.Name[1].String() != "verse" {
+		t.Errorf("unexpected pattern names block %+v", f.Blocks[0])
+	}
+	if cn, ok := f.Blocks[1].(*block.ChannelNames); !ok || len(cn.Name) != 2 || cn.Name[1].String() != "bass" {
+		t.Errorf("unexpected channel names block %+v", f.Blocks[1])
+	}
+	if p, ok := f.Blocks[2].(*block.FX); !ok || p.LibraryName.String() != "Echo" || !bytes.Equal(p.Data, []byte{1, 2, 3, 4}) {
+		t.Errorf("unexpected plugin block %+v", f.Blocks[2])
+	}
+	if string(f.Unparsed.Trailing) != "trailing data" {
+		t.Errorf("unexpected trailing data %q", f.Unparsed.Trailing)
+	}
+}